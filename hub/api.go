@@ -0,0 +1,120 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/pkg/errors"
+)
+
+// linkNextRegexp matches the URL of the next page in an HTTP "Link" header, e.g.:
+//
+//	Link: <https://huggingface.co/api/models?cursor=xyz>; rel="next"
+var linkNextRegexp = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// nextPageURL returns the URL of the next page, given in the "Link" header of a paginated response of the
+// HuggingFace Hub API. It returns "" if there is no next page.
+func nextPageURL(linkHeader string) string {
+	matches := linkNextRegexp.FindStringSubmatch(linkHeader)
+	if matches == nil {
+		return ""
+	}
+	return matches[1]
+}
+
+// fetchAPI fetches the JSON served by the HuggingFace Hub API at apiURL, and decodes it into v.
+func fetchAPI(ctx context.Context, r *Repo, apiURL string, v any) error {
+	return sendAPI(ctx, r, &downloader.Request{URL: apiURL}, v)
+}
+
+// sendJSON sends the payload, encoded as JSON, to the HuggingFace Hub API at apiURL with the given HTTP method,
+// and decodes the JSON response into v, if v is not nil.
+//
+// Only idempotent methods are retried on failure, see downloader.Request.Retryable.
+func sendJSON(ctx context.Context, r *Repo, method, apiURL string, payload, v any) error {
+	req, err := newJSONRequest(method, apiURL, payload)
+	if err != nil {
+		return err
+	}
+	return sendAPI(ctx, r, req, v)
+}
+
+// newJSONRequest returns a request to the HuggingFace Hub API at apiURL, with the payload encoded as JSON.
+func newJSONRequest(method, apiURL string, payload any) (*downloader.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode request to %q", apiURL)
+	}
+	return &downloader.Request{
+		Method: method,
+		URL:    apiURL,
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body:   bytes.NewReader(body),
+	}, nil
+}
+
+// sendAPI sends the request to the HuggingFace Hub API, and decodes the JSON response into v, if v is not nil.
+func sendAPI(ctx context.Context, r *Repo, req *downloader.Request, v any) error {
+	if r.offline {
+		return errors.WithMessagef(ErrOfflineNotCached, "request to %q", req.URL)
+	}
+	content, _, err := r.getDownloadManager().Send(ctx, req)
+	if err != nil {
+		return asHTTPError(err)
+	}
+	if v == nil {
+		return nil
+	}
+	if err = json.Unmarshal(content, v); err != nil {
+		return errors.Wrapf(err, "failed to parse response from %q", req.URL)
+	}
+	return nil
+}
+
+// iterAPIPages fetches the JSON array served by the HuggingFace Hub API at pageURL, and yields its elements.
+// It follows the "Link" headers with rel="next" to the following pages, which are only fetched as the iteration
+// progresses.
+func iterAPIPages[T any](ctx context.Context, r *Repo, pageURL string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		if r.offline {
+			yield(zero, errors.WithMessagef(ErrOfflineNotCached, "request to %q", pageURL))
+			return
+		}
+		downloadManager := r.getDownloadManager()
+		for pageURL != "" {
+			content, header, err := downloadManager.Fetch(ctx, pageURL)
+			if err != nil {
+				yield(zero, asHTTPError(err))
+				return
+			}
+			var page []T
+			if err = json.Unmarshal(content, &page); err != nil {
+				yield(zero, errors.Wrapf(err, "failed to parse response from %q", pageURL))
+				return
+			}
+			for _, element := range page {
+				if !yield(element, nil) {
+					return
+				}
+			}
+			pageURL = nextPageURL(header.Get("Link"))
+		}
+	}
+}
+
+// escapePath escapes each of the "/" separated elements of p to be used in a URL path.
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for ii, part := range parts {
+		parts[ii] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package hub
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the modification time of the file: the last access time is not available in this platform.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
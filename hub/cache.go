@@ -0,0 +1,366 @@
+package hub
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/gomlx/go-huggingface/internal/files"
+	"github.com/pkg/errors"
+)
+
+// CacheInfo holds the contents of a HuggingFace Hub cache directory, as returned by ScanCache.
+//
+// It mirrors the HFCacheInfo returned by huggingface_hub's scan_cache_dir.
+type CacheInfo struct {
+	// Dir is the scanned cache directory.
+	Dir string
+
+	// Repos found in the cache, sorted by type and ID.
+	Repos []*CachedRepo
+
+	// SizeOnDisk of all repositories, in bytes.
+	SizeOnDisk int64
+
+	// Warnings about problems found in the cache: broken symlinks, orphan blobs, stale lock files, etc.
+	// They don't prevent the cache from being used.
+	Warnings []*CacheWarning
+}
+
+// CachedRepo holds information about one repository in the cache.
+type CachedRepo struct {
+	// ID of the repository, e.g.: "google/gemma-2-2b-it".
+	ID string
+
+	// Type of the repository.
+	Type RepoType
+
+	// Path to the repository cache directory.
+	Path string
+
+	// Revisions (snapshots) in the cache, sorted by commit-hash.
+	Revisions []*CachedRevision
+
+	// NumFiles is the number of blobs in the repository cache.
+	NumFiles int
+
+	// SizeOnDisk of the repository, in bytes: blobs shared by multiple revisions are only counted once.
+	SizeOnDisk int64
+
+	// LastAccessed and LastModified are the latest access and modification times of any of the repository blobs.
+	LastAccessed, LastModified time.Time
+}
+
+// CachedRevision holds information about one revision (snapshot) of a repository in the cache.
+type CachedRevision struct {
+	// CommitHash of the revision.
+	CommitHash string
+
+	// SnapshotPath is the path to the snapshot directory of the revision.
+	SnapshotPath string
+
+	// Refs (branches or tags, e.g.: "main") pointing to this revision.
+	Refs []string
+
+	// Files in the snapshot, sorted by name.
+	Files []*CachedFile
+
+	// SizeOnDisk of the files of the revision, in bytes. Blobs linked by more than one file are only counted once.
+	SizeOnDisk int64
+
+	// LastAccessed and LastModified are the latest access and modification times of any of the revision blobs.
+	LastAccessed, LastModified time.Time
+}
+
+// CachedFile holds information about one file of a revision in the cache.
+type CachedFile struct {
+	// Name of the file in the repository, e.g.: "onnx/model.onnx".
+	Name string
+
+	// FilePath is the path of the file in the snapshot directory, usually a symbolic link to the blob.
+	FilePath string
+
+	// BlobPath is the path to the blob holding the file contents.
+	BlobPath string
+
+	// Size of the file in bytes.
+	Size int64
+
+	// LastAccessed and LastModified times of the blob.
+	LastAccessed, LastModified time.Time
+}
+
+// CacheWarningKind enumerates the types of problems reported by ScanCache.
+type CacheWarningKind string
+
+const (
+	// WarningInvalidRepoDir is reported for entries in the cache directory that are not a repository.
+	WarningInvalidRepoDir CacheWarningKind = "invalid_repo_dir"
+
+	// WarningBrokenSymlink is reported for snapshot files pointing to a missing blob.
+	WarningBrokenSymlink CacheWarningKind = "broken_symlink"
+
+	// WarningOrphanBlob is reported for blobs not linked by any snapshot.
+	WarningOrphanBlob CacheWarningKind = "orphan_blob"
+
+	// WarningDanglingRef is reported for "refs/<revision>" files pointing to a snapshot not in the cache.
+	WarningDanglingRef CacheWarningKind = "dangling_ref"
+
+	// WarningStaleLock is reported for ".lock" files not held by any process, left behind by crashed programs.
+	WarningStaleLock CacheWarningKind = "stale_lock"
+
+	// WarningStaleDownload is reported for ".downloading" files of interrupted downloads, not currently being downloaded.
+	// They can be resumed by downloading the file again.
+	WarningStaleDownload CacheWarningKind = "stale_download"
+)
+
+// CacheWarning describes a problem found by ScanCache.
+type CacheWarning struct {
+	Kind CacheWarningKind
+
+	// Path of the file or directory with the problem.
+	Path string
+
+	// Message describing the problem.
+	Message string
+}
+
+// String implements fmt.Stringer.
+func (w *CacheWarning) String() string {
+	return fmt.Sprintf("%s: %s (%s)", w.Kind, w.Message, w.Path)
+}
+
+// ScanCache scans the HuggingFace Hub cache directory (e.g.: DefaultCacheDir), and returns structured information
+// about its repositories, revisions and files, including their sizes on disk.
+//
+// It mirrors huggingface_hub's scan_cache_dir, and it can be used with caches created by the Python library.
+// Problems found in the cache are reported in CacheInfo.Warnings, and only errors accessing cacheDir itself
+// are returned.
+func ScanCache(cacheDir string) (*CacheInfo, error) {
+	cacheDir, err := files.ReplaceTildeInDir(cacheDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve directory %q", cacheDir)
+	}
+	cacheDir = path.Clean(cacheDir)
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to scan cache directory %q", cacheDir)
+	}
+	cache := &CacheInfo{Dir: cacheDir}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			// Hidden entries, like huggingface_hub ".locks" directory.
+			continue
+		}
+		repoDir := path.Join(cacheDir, name)
+		repoType, repoID, ok := parseFlatFolderName(name)
+		if !entry.IsDir() || !ok {
+			cache.warnf(WarningInvalidRepoDir, repoDir, "not a repository cache directory")
+			continue
+		}
+		repo := cache.scanRepo(repoDir, repoType, repoID)
+		cache.Repos = append(cache.Repos, repo)
+		cache.SizeOnDisk += repo.SizeOnDisk
+	}
+	slices.SortFunc(cache.Repos, func(a, b *CachedRepo) int {
+		if a.Type != b.Type {
+			return strings.Compare(string(a.Type), string(b.Type))
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	slices.SortStableFunc(cache.Warnings, func(a, b *CacheWarning) int { return strings.Compare(a.Path, b.Path) })
+	return cache, nil
+}
+
+// parseFlatFolderName is the reverse of Repo.flatFolderName.
+func parseFlatFolderName(name string) (repoType RepoType, id string, ok bool) {
+	parts := strings.Split(name, RepoIdSeparator)
+	if len(parts) < 2 {
+		return
+	}
+	repoType = RepoType(parts[0])
+	switch repoType {
+	case RepoTypeModel, RepoTypeDataset, RepoTypeSpace:
+	default:
+		return
+	}
+	return repoType, strings.Join(parts[1:], "/"), true
+}
+
+// warnf adds a warning to the CacheInfo.
+func (c *CacheInfo) warnf(kind CacheWarningKind, filePath, format string, args ...any) {
+	c.Warnings = append(c.Warnings, &CacheWarning{Kind: kind, Path: filePath, Message: fmt.Sprintf(format, args...)})
+}
+
+// scanRepo scans one repository cache directory.
+func (c *CacheInfo) scanRepo(repoDir string, repoType RepoType, repoID string) *CachedRepo {
+	repo := &CachedRepo{ID: repoID, Type: repoType, Path: repoDir}
+
+	// Blobs: sizes and times, and stale lock and download files.
+	blobsDir := path.Join(repoDir, "blobs")
+	blobs := make(map[string]os.FileInfo)
+	if entries, err := os.ReadDir(blobsDir); err == nil {
+		for _, entry := range entries {
+			blobPath := path.Join(blobsDir, entry.Name())
+			if c.checkLockOrDownload(blobPath) || !entry.Type().IsRegular() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue // Removed concurrently.
+			}
+			blobs[blobPath] = info
+			repo.NumFiles++
+			repo.SizeOnDisk += info.Size()
+			repo.LastAccessed = latest(repo.LastAccessed, accessTime(info))
+			repo.LastModified = latest(repo.LastModified, info.ModTime())
+		}
+	}
+	if entries, err := os.ReadDir(path.Join(repoDir, "info")); err == nil {
+		for _, entry := range entries {
+			c.checkLockOrDownload(path.Join(repoDir, "info", entry.Name()))
+		}
+	}
+
+	// Refs: map commit-hash to the refs pointing to it.
+	commitToRefs := make(map[string][]string)
+	refsDir := path.Join(repoDir, "refs")
+	if files.Exists(refsDir) {
+		_ = filepath.WalkDir(refsDir, func(refPath string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			contents, err := os.ReadFile(refPath)
+			if err != nil {
+				return nil
+			}
+			refName, _ := filepath.Rel(refsDir, refPath)
+			commitHash := strings.TrimSpace(string(contents))
+			commitToRefs[commitHash] = append(commitToRefs[commitHash], filepath.ToSlash(refName))
+			return nil
+		})
+	}
+
+	// Snapshots: one per revision.
+	linkedBlobs := make(map[string]bool)
+	snapshotsDir := path.Join(repoDir, "snapshots")
+	if entries, err := os.ReadDir(snapshotsDir); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			revision := c.scanRevision(path.Join(snapshotsDir, entry.Name()), blobs, linkedBlobs)
+			revision.Refs = commitToRefs[revision.CommitHash]
+			delete(commitToRefs, revision.CommitHash)
+			repo.Revisions = append(repo.Revisions, revision)
+		}
+	}
+	for commitHash, refs := range commitToRefs {
+		for _, ref := range refs {
+			c.warnf(WarningDanglingRef, path.Join(refsDir, ref), "ref %q points to commit %q, not in the cache", ref, commitHash)
+		}
+	}
+
+	// Blobs not linked by any snapshot.
+	for blobPath := range blobs {
+		if !linkedBlobs[blobPath] {
+			c.warnf(WarningOrphanBlob, blobPath, "blob not used by any snapshot of %s %q", repoType, repoID)
+		}
+	}
+	return repo
+}
+
+// readSymlink returns the path of the file the symbolic link at filePath points to.
+func readSymlink(filePath string) (string, error) {
+	target, err := os.Readlink(filePath)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(filePath), target)
+	}
+	return filepath.Clean(target), nil
+}
+
+// scanRevision scans a snapshot directory, marking the blobs it links to in linkedBlobs.
+func (c *CacheInfo) scanRevision(snapshotPath string, blobs map[string]os.FileInfo, linkedBlobs map[string]bool) *CachedRevision {
+	revision := &CachedRevision{CommitHash: path.Base(snapshotPath), SnapshotPath: snapshotPath}
+	revisionBlobs := make(map[string]bool)
+	_ = filepath.WalkDir(snapshotPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		blobPath := filePath
+		if entry.Type()&fs.ModeSymlink != 0 {
+			target, err := readSymlink(filePath)
+			if err != nil {
+				return nil
+			}
+			blobPath = target
+		}
+		info, found := blobs[blobPath]
+		if !found {
+			info, err = os.Stat(blobPath)
+			if err != nil {
+				c.warnf(WarningBrokenSymlink, filePath, "file points to missing blob %q", blobPath)
+				return nil
+			}
+		}
+		linkedBlobs[blobPath] = true
+		name, _ := filepath.Rel(snapshotPath, filePath)
+		revision.Files = append(revision.Files, &CachedFile{
+			Name:         filepath.ToSlash(name),
+			FilePath:     filePath,
+			BlobPath:     blobPath,
+			Size:         info.Size(),
+			LastAccessed: accessTime(info),
+			LastModified: info.ModTime(),
+		})
+		if !revisionBlobs[blobPath] {
+			revisionBlobs[blobPath] = true
+			revision.SizeOnDisk += info.Size()
+		}
+		revision.LastAccessed = latest(revision.LastAccessed, accessTime(info))
+		revision.LastModified = latest(revision.LastModified, info.ModTime())
+		return nil
+	})
+	slices.SortFunc(revision.Files, func(a, b *CachedFile) int { return strings.Compare(a.Name, b.Name) })
+	return revision
+}
+
+// checkLockOrDownload checks whether filePath is a ".lock" or a ".downloading" file, and if so whether it's stale
+// (not held by any process), in which case a warning is added.
+func (c *CacheInfo) checkLockOrDownload(filePath string) (isLockOrDownload bool) {
+	if lockedFile, found := strings.CutSuffix(filePath, ".lock"); found {
+		if !isFileLocked(filePath) {
+			c.warnf(WarningStaleLock, filePath, "lock file for %q not held by any process", path.Base(lockedFile))
+		}
+		return true
+	}
+	if strings.Contains(path.Base(filePath), ".downloading"+downloader.ChunksStateSuffix) {
+		// Progress of a chunked download, reported (and removed) with its ".downloading" file.
+		return true
+	}
+	if downloadedFile, found := strings.CutSuffix(filePath, ".downloading"); found {
+		if !isFileLocked(downloadedFile + ".lock") {
+			c.warnf(WarningStaleDownload, filePath, "interrupted download of %q", path.Base(downloadedFile))
+		}
+		return true
+	}
+	return false
+}
+
+// latest returns the latest of the two times.
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
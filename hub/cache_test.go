@@ -0,0 +1,143 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestCache creates a cache with one model with 2 revisions sharing a blob, and some problems.
+func createTestCache(t *testing.T) (cacheDir string) {
+	cacheDir = t.TempDir()
+	repoCacheDir := New("owner/model").WithCacheDir(cacheDir).RepoCacheDir()
+	const (
+		commit1 = "1111111111111111111111111111111111111111"
+		commit2 = "2222222222222222222222222222222222222222"
+	)
+	writeTestBlob(t, repoCacheDir, commit1, "config.json", "aaaa", []byte("{}"))
+	writeTestBlob(t, repoCacheDir, commit1, "model.bin", "bbbb", []byte("0123456789"))
+	writeTestBlob(t, repoCacheDir, commit2, "model.bin", "cccc", []byte("01234"))
+	require.NoError(t, createSymLink(path.Join(repoCacheDir, "snapshots", commit2, "config.json"),
+		path.Join(repoCacheDir, "blobs", "aaaa")))
+	require.NoError(t, os.MkdirAll(path.Join(repoCacheDir, "refs"), DefaultDirCreationPerm))
+	require.NoError(t, os.WriteFile(path.Join(repoCacheDir, "refs", "main"), []byte(commit2), DefaultFileCreationPerm))
+
+	// Problems: orphan blob, broken symlink, stale lock and stale download.
+	blobsDir := path.Join(repoCacheDir, "blobs")
+	require.NoError(t, os.WriteFile(path.Join(blobsDir, "orphan"), []byte("orphan"), DefaultFileCreationPerm))
+	require.NoError(t, createSymLink(path.Join(repoCacheDir, "snapshots", commit2, "missing.txt"), path.Join(blobsDir, "missing")))
+	require.NoError(t, os.WriteFile(path.Join(blobsDir, "dddd.lock"), nil, DefaultFileCreationPerm))
+	require.NoError(t, os.WriteFile(path.Join(blobsDir, "dddd.downloading"), []byte("partial"), DefaultFileCreationPerm))
+
+	// A dataset repo.
+	datasetCacheDir := New("dataset").WithType(RepoTypeDataset).WithCacheDir(cacheDir).RepoCacheDir()
+	writeTestBlob(t, datasetCacheDir, "3333333333333333333333333333333333333333", "data/train.csv", "eeee", []byte("a,b"))
+	return
+}
+
+func TestScanCache(t *testing.T) {
+	cacheDir := createTestCache(t)
+	cache, err := ScanCache(cacheDir)
+	require.NoError(t, err)
+
+	require.Len(t, cache.Repos, 2)
+	dataset, model := cache.Repos[0], cache.Repos[1]
+	assert.Equal(t, RepoTypeDataset, dataset.Type)
+	assert.Equal(t, "dataset", dataset.ID)
+	assert.Equal(t, int64(3), dataset.SizeOnDisk)
+	assert.Equal(t, "data/train.csv", dataset.Revisions[0].Files[0].Name)
+
+	assert.Equal(t, RepoTypeModel, model.Type)
+	assert.Equal(t, "owner/model", model.ID)
+	assert.Equal(t, 4, model.NumFiles)
+	assert.Equal(t, int64(2+10+5+6), model.SizeOnDisk)
+	require.Len(t, model.Revisions, 2)
+	assert.Empty(t, model.Revisions[0].Refs)
+	assert.Equal(t, int64(12), model.Revisions[0].SizeOnDisk)
+	assert.Equal(t, []string{"main"}, model.Revisions[1].Refs)
+	assert.Equal(t, int64(7), model.Revisions[1].SizeOnDisk)
+	assert.False(t, model.LastModified.IsZero())
+	assert.Equal(t, int64(3+2+10+5+6), cache.SizeOnDisk)
+
+	var kinds []CacheWarningKind
+	for _, warning := range cache.Warnings {
+		kinds = append(kinds, warning.Kind)
+	}
+	assert.ElementsMatch(t, []CacheWarningKind{WarningStaleDownload, WarningStaleLock, WarningOrphanBlob, WarningBrokenSymlink}, kinds)
+
+	// Lock held: not reported as stale.
+	lockPath := path.Join(model.Path, "blobs", "dddd.lock")
+	require.NoError(t, execOnFileLock(context.Background(), slog.Default(), lockPath, func() {
+		cache, err = ScanCache(cacheDir)
+	}))
+	require.NoError(t, err)
+	for _, warning := range cache.Warnings {
+		assert.NotEqual(t, WarningStaleLock, warning.Kind)
+		assert.NotEqual(t, WarningStaleDownload, warning.Kind)
+	}
+}
+
+func TestDeleteStrategy(t *testing.T) {
+	cacheDir := createTestCache(t)
+	cache, err := ScanCache(cacheDir)
+	require.NoError(t, err)
+	model := cache.Repos[1]
+
+	_, err = cache.DeleteRevisions("unknown")
+	require.Error(t, err)
+
+	// Delete first revision: only the blob not shared with the second revision is removed.
+	strategy, err := cache.DeleteRevisions(model.Revisions[0].CommitHash)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), strategy.ExpectedFreedSize)
+	assert.Equal(t, []string{path.Join(model.Path, "blobs", "bbbb")}, strategy.Blobs)
+
+	// Blob in use: nothing of the revision is removed, and no lock files are left behind.
+	lockPath := path.Join(model.Path, "blobs", "bbbb.lock")
+	require.NoError(t, execOnFileLock(context.Background(), slog.Default(), lockPath, func() {
+		_, err = strategy.Execute()
+	}))
+	require.Error(t, err)
+	assert.DirExists(t, model.Revisions[0].SnapshotPath)
+	assert.FileExists(t, path.Join(model.Path, "blobs", "bbbb"))
+	assert.NoFileExists(t, path.Join(model.Path, "blobs", "aaaa.lock"))
+
+	freed, err := strategy.Execute()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), freed)
+	assert.NoDirExists(t, model.Revisions[0].SnapshotPath)
+	assert.NoFileExists(t, lockPath)
+	assert.NoFileExists(t, path.Join(model.Path, "blobs", "aaaa.lock"))
+
+	// Garbage collect: orphan blob, stale lock and stale download.
+	cache, err = ScanCache(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, cache.Repos[1].Revisions, 1)
+	strategy = cache.GarbageCollect()
+	assert.Equal(t, int64(len("orphan")+len("partial")), strategy.ExpectedFreedSize)
+	freed, err = strategy.Execute()
+	require.NoError(t, err)
+	assert.Equal(t, strategy.ExpectedFreedSize, freed)
+	cache, err = ScanCache(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, cache.Warnings, 1)
+	assert.Equal(t, WarningBrokenSymlink, cache.Warnings[0].Kind)
+
+	// Delete repository in use: it's skipped.
+	strategy, err = cache.DeleteRepo(RepoTypeModel, "owner/model")
+	require.NoError(t, err)
+	lockPath = path.Join(model.Path, "blobs", "ffff.lock")
+	require.NoError(t, execOnFileLock(context.Background(), slog.Default(), lockPath, func() {
+		_, err = strategy.Execute()
+	}))
+	require.Error(t, err)
+	assert.DirExists(t, model.Path)
+	_, err = strategy.Execute()
+	require.NoError(t, err)
+	assert.NoDirExists(t, model.Path)
+}
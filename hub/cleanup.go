@@ -0,0 +1,334 @@
+package hub
+
+import (
+	stderrors "errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/pkg/errors"
+)
+
+// DeleteStrategy lists what is going to be deleted from the cache, and how much space is expected to be freed.
+//
+// It is created by CacheInfo.DeleteRevisions, CacheInfo.DeleteRepo or CacheInfo.GarbageCollect, and nothing is
+// deleted until DeleteStrategy.Execute is called, so it can be used as a dry-run.
+// It mirrors huggingface_hub's DeleteCacheStrategy.
+type DeleteStrategy struct {
+	// ExpectedFreedSize in bytes, if the strategy is executed.
+	ExpectedFreedSize int64
+
+	// Repos cache directories to delete entirely.
+	Repos []string
+
+	// Snapshots directories to delete.
+	Snapshots []string
+
+	// Refs files to delete.
+	Refs []string
+
+	// Blobs to delete.
+	Blobs []string
+
+	// StaleFiles are ".lock" and ".downloading" files left behind by crashed or interrupted programs.
+	StaleFiles []string
+}
+
+// DeleteRevisions returns the strategy to delete the revisions with the given commit-hashes from the cache: their
+// snapshots, the refs pointing to them and the blobs not used by any other revision.
+// If all revisions of a repository are deleted, the whole repository cache directory is deleted.
+//
+// It returns an error if any of the commit-hashes is not in the cache.
+func (c *CacheInfo) DeleteRevisions(commitHashes ...string) (*DeleteStrategy, error) {
+	toDelete := make(map[string]bool, len(commitHashes))
+	for _, commitHash := range commitHashes {
+		toDelete[commitHash] = false
+	}
+	s := &DeleteStrategy{}
+	for _, repo := range c.Repos {
+		var deleted, kept []*CachedRevision
+		for _, revision := range repo.Revisions {
+			if _, found := toDelete[revision.CommitHash]; found {
+				toDelete[revision.CommitHash] = true
+				deleted = append(deleted, revision)
+			} else {
+				kept = append(kept, revision)
+			}
+		}
+		if len(deleted) == 0 {
+			continue
+		}
+		if len(kept) == 0 {
+			s.Repos = append(s.Repos, repo.Path)
+			s.ExpectedFreedSize += repo.SizeOnDisk
+			continue
+		}
+
+		keptBlobs := make(map[string]bool)
+		for _, revision := range kept {
+			for _, file := range revision.Files {
+				keptBlobs[file.BlobPath] = true
+			}
+		}
+		for _, revision := range deleted {
+			s.Snapshots = append(s.Snapshots, revision.SnapshotPath)
+			for _, ref := range revision.Refs {
+				s.Refs = append(s.Refs, path.Join(repo.Path, "refs", ref))
+			}
+			for _, file := range revision.Files {
+				if keptBlobs[file.BlobPath] {
+					continue
+				}
+				keptBlobs[file.BlobPath] = true // So it's not counted twice.
+				s.Blobs = append(s.Blobs, file.BlobPath)
+				s.ExpectedFreedSize += file.Size
+			}
+		}
+	}
+
+	var notFound []string
+	for _, commitHash := range commitHashes {
+		if !toDelete[commitHash] {
+			notFound = append(notFound, commitHash)
+		}
+	}
+	if len(notFound) > 0 {
+		return nil, errors.Errorf("revisions %q not found in cache %q", notFound, c.Dir)
+	}
+	return s, nil
+}
+
+// DeleteRepo returns the strategy to delete the whole cache directory of the given repository.
+//
+// It returns an error if the repository is not in the cache.
+func (c *CacheInfo) DeleteRepo(repoType RepoType, id string) (*DeleteStrategy, error) {
+	for _, repo := range c.Repos {
+		if repo.Type == repoType && repo.ID == id {
+			return &DeleteStrategy{ExpectedFreedSize: repo.SizeOnDisk, Repos: []string{repo.Path}}, nil
+		}
+	}
+	return nil, errors.Errorf("repository %s %q not found in cache %q", repoType, id, c.Dir)
+}
+
+// GarbageCollect returns the strategy to delete the blobs not used by any snapshot, and the stale ".lock" and
+// ".downloading" files left behind by crashed or interrupted programs, as reported in CacheInfo.Warnings.
+func (c *CacheInfo) GarbageCollect() *DeleteStrategy {
+	s := &DeleteStrategy{}
+	for _, warning := range c.Warnings {
+		switch warning.Kind {
+		case WarningOrphanBlob:
+			s.Blobs = append(s.Blobs, warning.Path)
+		case WarningStaleLock, WarningStaleDownload:
+			s.StaleFiles = append(s.StaleFiles, warning.Path)
+		default:
+			continue
+		}
+		if info, err := os.Stat(warning.Path); err == nil {
+			s.ExpectedFreedSize += info.Size()
+		}
+	}
+	return s
+}
+
+// Execute the strategy, deleting the files and directories from the cache. It returns the number of bytes freed.
+//
+// It is safe to execute while other programs use the cache: everything is deleted while holding the locks used
+// by the downloads (see execOnFileLock), and what is in use by another program is skipped and reported in the
+// returned error:
+//
+//   - The snapshots, refs and blobs of the deleted revisions are deleted together, holding the locks of all the
+//     blobs they use: if any of them is in use, none of them is deleted.
+//   - Each stale file is deleted holding its lock.
+//   - Each repository is deleted holding the locks of all its files.
+//
+// Errors don't interrupt the execution of the rest of the strategy.
+func (s *DeleteStrategy) Execute() (freed int64, err error) {
+	return s.execute(slog.Default())
+}
+
+// execute implements Execute, reporting problems with the locks to logger.
+func (s *DeleteStrategy) execute(logger *slog.Logger) (freed int64, err error) {
+	var errs []error
+	if len(s.Refs) > 0 || len(s.Snapshots) > 0 || len(s.Blobs) > 0 {
+		size, err := s.removeRevisions(logger)
+		freed += size
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, filePath := range s.StaleFiles {
+		lockPath := filePath
+		if downloadedFile, found := strings.CutSuffix(filePath, ".downloading"); found {
+			lockPath = downloadedFile + ".lock"
+		}
+		size, err := removeUnlocked(logger, filePath, lockPath)
+		freed += size
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, repoDir := range s.Repos {
+		size, err := removeRepoDir(logger, repoDir)
+		freed += size
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return freed, stderrors.Join(errs...)
+}
+
+// removeRevisions removes the refs, snapshots and blobs of the strategy, holding the locks of the blobs to remove
+// and of the blobs linked by the snapshots, and it returns the number of bytes freed.
+func (s *DeleteStrategy) removeRevisions(logger *slog.Logger) (freed int64, err error) {
+	blobPaths := slices.Clone(s.Blobs)
+	for _, snapshotPath := range s.Snapshots {
+		_ = filepath.WalkDir(snapshotPath, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+			if blobPath, err := readSymlink(filePath); err == nil && path.Base(path.Dir(blobPath)) == "blobs" {
+				blobPaths = append(blobPaths, blobPath)
+			}
+			return nil
+		})
+	}
+	slices.Sort(blobPaths)
+	blobPaths = slices.Compact(blobPaths)
+	lockPaths := make([]string, len(blobPaths))
+	for ii, blobPath := range blobPaths {
+		lockPaths[ii] = blobPath + ".lock"
+	}
+
+	var errs []error
+	inUse, err := tryExecOnFileLocks(logger, lockPaths, func() {
+		for _, refPath := range s.Refs {
+			if err := os.Remove(refPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, errors.Wrapf(err, "failed to remove ref %q", refPath))
+			}
+		}
+		for _, snapshotPath := range s.Snapshots {
+			if err := os.RemoveAll(snapshotPath); err != nil {
+				errs = append(errs, errors.Wrapf(err, "failed to remove snapshot %q", snapshotPath))
+			}
+		}
+		for _, blobPath := range s.Blobs {
+			info, err := os.Stat(blobPath)
+			if err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					errs = append(errs, errors.Wrapf(err, "failed to remove %q", blobPath))
+				}
+				continue
+			}
+			if err = os.Remove(blobPath); err != nil {
+				errs = append(errs, errors.Wrapf(err, "failed to remove %q", blobPath))
+				continue
+			}
+			freed += info.Size()
+		}
+		// Remove lock files while holding the locks, the same way lockedDownload does after downloading a file.
+		for _, lockPath := range lockPaths {
+			if err := os.Remove(lockPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, errors.Wrapf(err, "failed to remove lock file %q", lockPath))
+			}
+		}
+	})
+	if err != nil {
+		return freed, errors.WithMessage(err, "while removing revisions")
+	}
+	if inUse != "" {
+		return 0, errors.Errorf("blob %q is in use (locked in %q) by another program, revisions not removed",
+			strings.TrimSuffix(inUse, ".lock"), inUse)
+	}
+	return freed, stderrors.Join(errs...)
+}
+
+// removeUnlocked removes filePath if lockPath is not held by any other program, and it returns the number of bytes freed.
+// The lockPath is also removed, while holding the lock (see tryLockFile), so it's safe to remove stale lock files.
+func removeUnlocked(logger *slog.Logger, filePath, lockPath string) (freed int64, err error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "failed to remove %q", filePath)
+	}
+	var mainErr error
+	acquired, err := tryExecOnFileLock(logger, lockPath, func() {
+		if strings.HasSuffix(filePath, ".downloading") {
+			// Also removes the saved progress of chunked downloads.
+			if mainErr = downloader.RemovePartialDownload(filePath); mainErr != nil {
+				return
+			}
+		} else if filePath != lockPath {
+			if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				mainErr = errors.Wrapf(err, "failed to remove %q", filePath)
+				return
+			}
+		}
+		freed = info.Size()
+		// Remove lock file while holding the lock, the same way lockedDownload does after downloading a file.
+		if err := os.Remove(lockPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			mainErr = errors.Wrapf(err, "failed to remove lock file %q", lockPath)
+		}
+	})
+	if err != nil {
+		return freed, errors.WithMessagef(err, "while removing %q", filePath)
+	}
+	if !acquired {
+		return 0, errors.Errorf("%q is in use (locked in %q) by another program, not removed", filePath, lockPath)
+	}
+	return freed, mainErr
+}
+
+// removeRepoDir removes the whole repository cache directory, holding the locks of all its blobs and of its
+// other lock files, so it is only removed if none of them is held by any other program.
+// It returns the number of bytes freed.
+func removeRepoDir(logger *slog.Logger, repoDir string) (freed int64, err error) {
+	var size int64
+	var lockPaths []string
+	err = filepath.Walk(repoDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		size += info.Size()
+		if strings.HasSuffix(filePath, ".lock") {
+			lockPaths = append(lockPaths, filePath)
+		} else if path.Base(path.Dir(filePath)) == "blobs" {
+			blobPath := strings.TrimSuffix(strings.TrimSuffix(filePath, downloader.ChunksStateSuffix), ".downloading")
+			lockPaths = append(lockPaths, blobPath+".lock")
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	slices.Sort(lockPaths)
+	lockPaths = slices.Compact(lockPaths)
+
+	var mainErr error
+	inUse, err := tryExecOnFileLocks(logger, lockPaths, func() {
+		if err := os.RemoveAll(repoDir); err != nil {
+			mainErr = errors.Wrapf(err, "failed to remove repository cache %q", repoDir)
+			return
+		}
+		freed = size
+	})
+	if err != nil {
+		return freed, errors.WithMessagef(err, "while removing repository cache %q", repoDir)
+	}
+	if inUse != "" {
+		return 0, errors.Errorf("repository cache %q is in use (locked in %q) by another program, not removed", repoDir, inUse)
+	}
+	return freed, mainErr
+}
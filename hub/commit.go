@@ -0,0 +1,455 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/gomlx/go-huggingface/internal/files"
+	"github.com/pkg/errors"
+)
+
+// CommitOperation is one of the changes of a commit created with Repo.CreateCommit:
+// one of *CommitOperationAdd, *CommitOperationDelete or *CommitOperationCopy.
+type CommitOperation interface {
+	// pathInRepo returns the path of the file or folder in the repository changed by the operation.
+	pathInRepo() string
+}
+
+// CommitOperationAdd adds or updates a file in the repository.
+//
+// Either LocalPath or Content must be set. Large files are uploaded with git LFS, as decided by the HuggingFace Hub.
+type CommitOperationAdd struct {
+	// PathInRepo where to store the file, e.g.: "model.safetensors" or "onnx/model.onnx".
+	PathInRepo string
+
+	// LocalPath of the file to upload.
+	LocalPath string
+
+	// Content of the file to upload, used if LocalPath is empty.
+	Content []byte
+}
+
+// CommitOperationDelete deletes a file or a folder (with all its contents) from the repository.
+type CommitOperationDelete struct {
+	PathInRepo string
+
+	// IsFolder must be set to delete a folder.
+	IsFolder bool
+}
+
+// CommitOperationCopy copies a file already in the repository to a new path.
+type CommitOperationCopy struct {
+	// SrcPathInRepo is the file to copy.
+	SrcPathInRepo string
+
+	// PathInRepo is where to copy the file to.
+	PathInRepo string
+
+	// SrcRevision from where to copy the file. Defaults to the revision of the Repo (see Repo.WithRevision).
+	SrcRevision string
+}
+
+func (op *CommitOperationAdd) pathInRepo() string    { return op.PathInRepo }
+func (op *CommitOperationDelete) pathInRepo() string { return op.PathInRepo }
+func (op *CommitOperationCopy) pathInRepo() string   { return op.PathInRepo }
+
+// uploadReader reads the contents of a file to be uploaded: it's either an *os.File or a bytesReadCloser.
+type uploadReader interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+// open the contents of the file to be uploaded.
+func (op *CommitOperationAdd) open() (uploadReader, error) {
+	if op.LocalPath == "" {
+		return bytesReadCloser{bytes.NewReader(op.Content)}, nil
+	}
+	f, err := os.Open(op.LocalPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %q to upload as %q", op.LocalPath, op.PathInRepo)
+	}
+	return f, nil
+}
+
+// bytesReadCloser adds a no-op Close method to a bytes.Reader.
+type bytesReadCloser struct {
+	*bytes.Reader
+}
+
+func (bytesReadCloser) Close() error { return nil }
+
+// Upload modes returned by the preupload API.
+const (
+	uploadModeRegular = "regular"
+	uploadModeLFS     = "lfs"
+)
+
+// preuploadBatchSize is the maximum number of files in each call to the preupload API, the same used by
+// huggingface_hub.
+const preuploadBatchSize = 256
+
+// commitFile holds the information of a file to be added in a commit.
+type commitFile struct {
+	op     *CommitOperationAdd
+	size   int64
+	sha256 string
+
+	// sample are the first 512 bytes of the file, used by the preupload API to decide the upload mode.
+	sample []byte
+
+	// uploadMode is either uploadModeRegular (contents are sent with the commit) or uploadModeLFS.
+	uploadMode string
+
+	// shouldIgnore is set if the file is ignored by the repository (".gitignore"), and is not committed.
+	shouldIgnore bool
+}
+
+// newCommitFile reads the file to be added, to calculate its size, SHA256 and sample.
+func newCommitFile(op *CommitOperationAdd) (*commitFile, error) {
+	reader, err := op.open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+	cf := &commitFile{op: op}
+	hasher := sha256.New()
+	var sample bytes.Buffer
+	cf.size, err = io.Copy(io.MultiWriter(hasher, &limitedWriter{w: &sample, n: 512}), reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the contents of %q", op.PathInRepo)
+	}
+	cf.sha256 = hex.EncodeToString(hasher.Sum(nil))
+	cf.sample = sample.Bytes()
+	return cf, nil
+}
+
+// limitedWriter writes at most n bytes to w, and silently discards the rest.
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if lw.n > 0 {
+		toWrite := min(len(p), lw.n)
+		if _, err := lw.w.Write(p[:toWrite]); err != nil {
+			return 0, err
+		}
+		lw.n -= toWrite
+	}
+	return len(p), nil
+}
+
+// CreateCommit creates a commit in the revision (which must be a branch) of the repository, with the given
+// operations, and returns the commit-hash of the new commit. It is the equivalent of huggingface_hub's create_commit.
+//
+// Files to be added are first checked with the HuggingFace Hub (the "preupload" API), which decides which ones are
+// uploaded with git LFS: those are uploaded to the LFS storage before the commit is created (in parallel, and in
+// multiple parts if the server asks for it), and only their SHA256 is sent in the commit.
+//
+// Example:
+//
+//	commitHash, err := repo.CreateCommit(ctx, []hub.CommitOperation{
+//		&hub.CommitOperationAdd{PathInRepo: "model.safetensors", LocalPath: "/tmp/model.safetensors"},
+//		&hub.CommitOperationDelete{PathInRepo: "model.bin"},
+//	}, "Convert model to safetensors")
+//
+// It requires the Repo to be configured with an authentication token with write access (see Repo.WithAuth).
+func (r *Repo) CreateCommit(ctx context.Context, ops []CommitOperation, message string) (commitHash string, err error) {
+	if len(ops) == 0 {
+		return "", errors.Errorf("no operations given to commit to repository %q", r.ID)
+	}
+	if message == "" {
+		return "", errors.Errorf("a commit message is required to commit to repository %q", r.ID)
+	}
+	var commitFiles []*commitFile
+	for _, op := range ops {
+		if cleanRelativeFilePath(op.pathInRepo()) == "." {
+			return "", errors.Errorf("invalid path %q in commit operation", op.pathInRepo())
+		}
+		if addOp, ok := op.(*CommitOperationAdd); ok {
+			cf, err := newCommitFile(addOp)
+			if err != nil {
+				return "", err
+			}
+			commitFiles = append(commitFiles, cf)
+		}
+	}
+
+	if err = r.preupload(ctx, commitFiles); err != nil {
+		return "", errors.WithMessagef(err, "while checking files to upload to repository %q", r.ID)
+	}
+	var lfsFiles []*commitFile
+	for _, cf := range commitFiles {
+		if cf.uploadMode == uploadModeLFS && !cf.shouldIgnore {
+			lfsFiles = append(lfsFiles, cf)
+		}
+	}
+	if err = r.uploadLFSFiles(ctx, lfsFiles); err != nil {
+		return "", errors.WithMessagef(err, "while uploading LFS files to repository %q", r.ID)
+	}
+
+	payload, err := r.commitPayload(ctx, ops, commitFiles, message)
+	if err != nil {
+		return "", err
+	}
+	commitURL := fmt.Sprintf("%s/commit/%s", r.apiURL(), url.PathEscape(r.revision))
+	var response struct {
+		CommitOID string `json:"commitOid"`
+		CommitURL string `json:"commitUrl"`
+	}
+	// The commit is not retried on failures (see downloader.Request.Retryable): it could create a duplicate commit.
+	err = sendAPI(ctx, r, &downloader.Request{
+		Method: http.MethodPost,
+		URL:    commitURL,
+		Header: http.Header{"Content-Type": {"application/x-ndjson"}},
+		Body:   bytes.NewReader(payload),
+	}, &response)
+	if err != nil {
+		return "", errors.WithMessagef(err, "while creating commit in repository %q", r.ID)
+	}
+	return response.CommitOID, nil
+}
+
+// preupload asks the HuggingFace Hub the upload mode (regular or LFS) of each file, and whether they should be ignored.
+func (r *Repo) preupload(ctx context.Context, commitFiles []*commitFile) error {
+	preuploadURL := fmt.Sprintf("%s/preupload/%s", r.apiURL(), url.PathEscape(r.revision))
+	type preuploadFile struct {
+		Path         string `json:"path"`
+		Sample       string `json:"sample,omitempty"`
+		Size         int64  `json:"size,omitempty"`
+		SHA          string `json:"sha,omitempty"`
+		UploadMode   string `json:"uploadMode,omitempty"`
+		ShouldIgnore bool   `json:"shouldIgnore,omitempty"`
+	}
+	for start := 0; start < len(commitFiles); start += preuploadBatchSize {
+		batch := commitFiles[start:min(start+preuploadBatchSize, len(commitFiles))]
+		var request, response struct {
+			Files []preuploadFile `json:"files"`
+		}
+		byPath := make(map[string]*commitFile, len(batch))
+		for _, cf := range batch {
+			request.Files = append(request.Files, preuploadFile{
+				Path:   cf.op.PathInRepo,
+				Sample: base64.StdEncoding.EncodeToString(cf.sample),
+				Size:   cf.size,
+				SHA:    cf.sha256,
+			})
+			byPath[cf.op.PathInRepo] = cf
+		}
+		req, err := newJSONRequest(http.MethodPost, preuploadURL, &request)
+		if err != nil {
+			return err
+		}
+		req.Retryable = true // It only queries the upload modes.
+		if err = sendAPI(ctx, r, req, &response); err != nil {
+			return err
+		}
+		for _, file := range response.Files {
+			if cf, found := byPath[file.Path]; found {
+				cf.uploadMode = file.UploadMode
+				cf.shouldIgnore = file.ShouldIgnore
+			}
+		}
+		for _, cf := range batch {
+			if cf.uploadMode != uploadModeRegular && cf.uploadMode != uploadModeLFS {
+				return errors.Errorf("invalid upload mode %q returned for file %q", cf.uploadMode, cf.op.PathInRepo)
+			}
+		}
+	}
+	return nil
+}
+
+// commitLine is one line of the body of the request to the commit API.
+type commitLine struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// commitPayload returns the body of the request to the commit API: one JSON value per line, starting with the
+// commit header, followed by one line per operation.
+func (r *Repo) commitPayload(ctx context.Context, ops []CommitOperation, commitFiles []*commitFile, message string) ([]byte, error) {
+	summary, description, _ := strings.Cut(message, "\n")
+	lines := []commitLine{{"header", map[string]string{
+		"summary":     strings.TrimSpace(summary),
+		"description": strings.TrimSpace(description),
+	}}}
+
+	// Files added.
+	for _, cf := range commitFiles {
+		if cf.shouldIgnore {
+			continue
+		}
+		if cf.uploadMode == uploadModeLFS {
+			lines = append(lines, commitLine{"lfsFile", map[string]any{
+				"path": cf.op.PathInRepo, "algo": "sha256", "oid": cf.sha256, "size": cf.size}})
+			continue
+		}
+		contents, err := readAllAndClose(cf.op.open())
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, commitLine{"file", map[string]string{
+			"path": cf.op.PathInRepo, "encoding": "base64", "content": base64.StdEncoding.EncodeToString(contents)}})
+	}
+
+	// Files copied and deleted.
+	for _, op := range ops {
+		switch op := op.(type) {
+		case *CommitOperationDelete:
+			if op.IsFolder {
+				lines = append(lines, commitLine{"deletedFolder", map[string]string{
+					"path": strings.TrimSuffix(op.PathInRepo, "/") + "/"}})
+			} else {
+				lines = append(lines, commitLine{"deletedFile", map[string]string{"path": op.PathInRepo}})
+			}
+		case *CommitOperationCopy:
+			line, err := r.copyOperationLine(ctx, op)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, line := range lines {
+		if err := encoder.Encode(line); err != nil {
+			return nil, errors.Wrapf(err, "failed to encode commit operation %q", line.Key)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// copyOperationLine returns the commit API line for a copy operation: LFS files are copied by referencing their
+// SHA256, while regular files are downloaded and added again.
+func (r *Repo) copyOperationLine(ctx context.Context, op *CommitOperationCopy) (line commitLine, err error) {
+	srcRevision := op.SrcRevision
+	if srcRevision == "" {
+		srcRevision = r.revision
+	}
+	entries, err := r.pathsInfo(ctx, srcRevision, op.SrcPathInRepo)
+	if err != nil {
+		return line, errors.WithMessagef(err, "while copying %q to %q", op.SrcPathInRepo, op.PathInRepo)
+	}
+	if len(entries) == 0 || entries[0].IsDir() {
+		return line, errors.Errorf("cannot copy %q to %q: file not found in revision %q of repository %q",
+			op.SrcPathInRepo, op.PathInRepo, srcRevision, r.ID)
+	}
+	entry := entries[0]
+	if entry.LFS != nil {
+		line.Key = "lfsFile"
+		line.Value = map[string]any{"path": op.PathInRepo, "algo": "sha256", "oid": entry.LFS.SHA256, "size": entry.LFS.Size}
+		return line, nil
+	}
+	srcURL := fmt.Sprintf("%s/resolve/%s/%s", r.repoURL(), url.PathEscape(srcRevision), escapePath(op.SrcPathInRepo))
+	contents, _, err := r.getDownloadManager().Fetch(ctx, srcURL)
+	if err != nil {
+		return line, errors.WithMessagef(asHTTPError(err), "while copying %q to %q", op.SrcPathInRepo, op.PathInRepo)
+	}
+	line.Key = "file"
+	line.Value = map[string]string{
+		"path": op.PathInRepo, "encoding": "base64", "content": base64.StdEncoding.EncodeToString(contents)}
+	return line, nil
+}
+
+// pathsInfo returns the information of the given paths in the revision of the repository, using the "paths-info" API.
+// Paths not found are not included.
+func (r *Repo) pathsInfo(ctx context.Context, revision string, paths ...string) ([]*TreeEntry, error) {
+	pathsInfoURL := fmt.Sprintf("%s/paths-info/%s", r.apiURL(), url.PathEscape(revision))
+	form := url.Values{"paths": paths, "expand": {"true"}}
+	var entries []*TreeEntry
+	err := sendAPI(ctx, r, &downloader.Request{
+		Method:    http.MethodPost,
+		URL:       pathsInfoURL,
+		Header:    http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+		Body:      strings.NewReader(form.Encode()),
+		Retryable: true, // It only queries information.
+	}, &entries)
+	return entries, err
+}
+
+// readAllAndClose reads all the contents of the reader returned by an open function, and closes it.
+func readAllAndClose(reader uploadReader, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read file to upload")
+	}
+	return contents, nil
+}
+
+// UploadFile uploads the local file to pathInRepo in the repository, in a new commit. It returns the commit-hash.
+//
+// If message is empty, a default commit message is used. See Repo.CreateCommit for details.
+func (r *Repo) UploadFile(ctx context.Context, localPath, pathInRepo, message string) (commitHash string, err error) {
+	localPath, err = files.ReplaceTildeInDir(localPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve path %q", localPath)
+	}
+	if message == "" {
+		message = fmt.Sprintf("Upload %s with go-huggingface", pathInRepo)
+	}
+	return r.CreateCommit(ctx, []CommitOperation{&CommitOperationAdd{PathInRepo: pathInRepo, LocalPath: localPath}}, message)
+}
+
+// UploadFolder uploads all the files in localDir, recursively, to the folder pathInRepo in the repository (use "" for
+// the root of the repository), in a new commit. It returns the commit-hash.
+//
+// Hidden ".git" directories and the metadata kept in ".cache/huggingface" (see Repo.DownloadToDir) are not uploaded.
+//
+// If message is empty, a default commit message is used. See Repo.CreateCommit for details.
+func (r *Repo) UploadFolder(ctx context.Context, localDir, pathInRepo, message string) (commitHash string, err error) {
+	localDir, err = files.ReplaceTildeInDir(localDir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve directory %q", localDir)
+	}
+	pathInRepo = strings.Trim(pathInRepo, "/")
+	var ops []CommitOperation
+	err = filepath.WalkDir(localDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(localDir, filePath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if entry.IsDir() {
+			if relPath == ".git" || relPath == ".cache/huggingface" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ops = append(ops, &CommitOperationAdd{PathInRepo: path.Join(pathInRepo, relPath), LocalPath: filePath})
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to list files to upload in %q", localDir)
+	}
+	if len(ops) == 0 {
+		return "", errors.Errorf("no files to upload in %q", localDir)
+	}
+	if message == "" {
+		message = "Upload folder with go-huggingface"
+	}
+	return r.CreateCommit(ctx, ops, message)
+}
@@ -0,0 +1,257 @@
+package hub
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHub implements the parts of the HuggingFace Hub API used to create commits, with a separate storage server
+// for the LFS uploads.
+type fakeHub struct {
+	t                *testing.T
+	hub, storage     *httptest.Server
+	mu               sync.Mutex
+	lfsObjects       map[string][]byte // sha256 -> contents.
+	parts            map[string][]byte // part URL path -> contents.
+	verified         []string
+	commitLines      []map[string]any
+	multipartMinSize int64
+	omittedOID       string // LFS object left out of the batch responses, if set.
+}
+
+func newFakeHub(t *testing.T) *fakeHub {
+	f := &fakeHub{t: t, lfsObjects: make(map[string][]byte), parts: make(map[string][]byte), multipartMinSize: 1000}
+	f.hub = httptest.NewServer(http.HandlerFunc(f.serveHub))
+	f.storage = httptest.NewServer(http.HandlerFunc(f.serveStorage))
+	t.Cleanup(f.hub.Close)
+	t.Cleanup(f.storage.Close)
+	return f
+}
+
+func (f *fakeHub) serveHub(w http.ResponseWriter, r *http.Request) {
+	t := f.t
+	require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+	switch r.URL.Path {
+	case "/api/models/owner/model/preupload/main":
+		var request struct {
+			Files []map[string]any `json:"files"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		for _, file := range request.Files {
+			file["uploadMode"] = "regular"
+			if file["size"].(float64) > 20 {
+				file["uploadMode"] = "lfs"
+			}
+			file["shouldIgnore"] = file["path"] == "ignored.txt"
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(&request))
+
+	case "/owner/model.git/info/lfs/objects/batch":
+		require.Equal(t, "application/vnd.git-lfs+json", r.Header.Get("Content-Type"))
+		var request struct {
+			Objects []struct {
+				OID  string `json:"oid"`
+				Size int64  `json:"size"`
+			} `json:"objects"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		var objects []map[string]any
+		for _, object := range request.Objects {
+			if object.OID == f.omittedOID {
+				continue
+			}
+			response := map[string]any{"oid": object.OID, "size": object.Size}
+			f.mu.Lock()
+			_, exists := f.lfsObjects[object.OID]
+			f.mu.Unlock()
+			if !exists {
+				upload := map[string]any{"href": fmt.Sprintf("%s/upload/%s", f.storage.URL, object.OID)}
+				if object.Size >= f.multipartMinSize {
+					const chunkSize = 10
+					header := map[string]string{"chunk_size": fmt.Sprint(chunkSize)}
+					for part := 1; int64(part-1)*chunkSize < object.Size; part++ {
+						header[fmt.Sprint(part)] = fmt.Sprintf("%s/part/%s/%d", f.storage.URL, object.OID, part)
+					}
+					upload["header"] = header
+				}
+				response["actions"] = map[string]any{
+					"upload": upload,
+					"verify": map[string]any{"href": f.hub.URL + "/verify"},
+				}
+			}
+			objects = append(objects, response)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{"transfer": "multipart", "objects": objects}))
+
+	case "/verify":
+		var request struct {
+			OID string `json:"oid"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, found := f.lfsObjects[request.OID]; !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.verified = append(f.verified, request.OID)
+
+	case "/api/models/owner/model/paths-info/main":
+		require.NoError(t, r.ParseForm())
+		switch r.PostForm.Get("paths") {
+		case "weights.bin":
+			_, _ = fmt.Fprint(w, `[{"type": "file", "path": "weights.bin", "size": 100, "oid": "x",
+				"lfs": {"oid": "1234", "size": 100, "pointerSize": 130}}]`)
+		case "config.json":
+			_, _ = fmt.Fprint(w, `[{"type": "file", "path": "config.json", "size": 2, "oid": "y"}]`)
+		default:
+			_, _ = fmt.Fprint(w, `[]`)
+		}
+
+	case "/owner/model/resolve/main/config.json":
+		_, _ = fmt.Fprint(w, `{}`)
+
+	case "/api/models/owner/model/commit/main":
+		require.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		scanner := bufio.NewScanner(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for scanner.Scan() {
+			var line map[string]any
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			f.commitLines = append(f.commitLines, line)
+		}
+		_, _ = fmt.Fprint(w, `{"commitOid": "0123456789abcdef0123456789abcdef01234567", "commitUrl": "x"}`)
+
+	default:
+		t.Errorf("unexpected request %s %q", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeHub) serveStorage(w http.ResponseWriter, r *http.Request) {
+	t := f.t
+	require.Empty(t, r.Header.Get("Authorization"), "authentication token sent to storage")
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPut && parts[0] == "upload":
+		contents, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		f.lfsObjects[parts[1]] = contents
+	case r.Method == http.MethodPut && parts[0] == "part":
+		contents, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		f.parts[r.URL.Path] = contents
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%s"`, parts[2]))
+	case r.Method == http.MethodPost && parts[0] == "upload":
+		var request struct {
+			OID   string `json:"oid"`
+			Parts []struct {
+				PartNumber int    `json:"partNumber"`
+				ETag       string `json:"etag"`
+			} `json:"parts"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		var contents []byte
+		for ii, part := range request.Parts {
+			require.Equal(t, ii+1, part.PartNumber)
+			require.Equal(t, fmt.Sprintf(`"etag-%d"`, part.PartNumber), part.ETag)
+			contents = append(contents, f.parts[fmt.Sprintf("/part/%s/%d", request.OID, part.PartNumber)]...)
+		}
+		f.lfsObjects[request.OID] = contents
+	default:
+		t.Errorf("unexpected storage request %s %q", r.Method, r.URL)
+	}
+}
+
+func TestCreateCommit(t *testing.T) {
+	f := newFakeHub(t)
+	f.multipartMinSize = 40
+	repo := New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint(f.hub.URL).WithAuth("secret")
+
+	localDir := t.TempDir()
+	bigContents := bytes.Repeat([]byte("0123456789"), 4)
+	bigContents = append(bigContents, 'x') // 41 bytes: multipart with 5 parts.
+	require.NoError(t, os.WriteFile(path.Join(localDir, "big.bin"), bigContents, DefaultFileCreationPerm))
+	mediumContents := []byte("medium sized file, uploaded with LFS")
+	bigSHA256, mediumSHA256 := sha256Hex(bigContents), sha256Hex(mediumContents)
+
+	commitHash, err := repo.CreateCommit(context.Background(), []CommitOperation{
+		&CommitOperationAdd{PathInRepo: "big.bin", LocalPath: path.Join(localDir, "big.bin")},
+		&CommitOperationAdd{PathInRepo: "sub/medium.bin", Content: mediumContents},
+		&CommitOperationAdd{PathInRepo: "README.md", Content: []byte("# Model")},
+		&CommitOperationAdd{PathInRepo: "ignored.txt", Content: []byte("ignored")},
+		&CommitOperationDelete{PathInRepo: "model.bin"},
+		&CommitOperationDelete{PathInRepo: "onnx", IsFolder: true},
+		&CommitOperationCopy{SrcPathInRepo: "weights.bin", PathInRepo: "weights-copy.bin"},
+		&CommitOperationCopy{SrcPathInRepo: "config.json", PathInRepo: "config-copy.json"},
+	}, "Update model\n\nWith a longer description.")
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", commitHash)
+
+	assert.Equal(t, bigContents, f.lfsObjects[bigSHA256])
+	assert.Equal(t, mediumContents, f.lfsObjects[mediumSHA256])
+	assert.Len(t, f.parts, 5)
+	sort.Strings(f.verified)
+	wantVerified := []string{bigSHA256, mediumSHA256}
+	sort.Strings(wantVerified)
+	assert.Equal(t, wantVerified, f.verified)
+
+	encode := func(contents string) string { return base64.StdEncoding.EncodeToString([]byte(contents)) }
+	want := []map[string]any{
+		{"key": "header", "value": map[string]any{"summary": "Update model", "description": "With a longer description."}},
+		{"key": "lfsFile", "value": map[string]any{"path": "big.bin", "algo": "sha256", "oid": bigSHA256, "size": 41.0}},
+		{"key": "lfsFile", "value": map[string]any{"path": "sub/medium.bin", "algo": "sha256", "oid": mediumSHA256, "size": 36.0}},
+		{"key": "file", "value": map[string]any{"path": "README.md", "encoding": "base64", "content": encode("# Model")}},
+		{"key": "deletedFile", "value": map[string]any{"path": "model.bin"}},
+		{"key": "deletedFolder", "value": map[string]any{"path": "onnx/"}},
+		{"key": "lfsFile", "value": map[string]any{"path": "weights-copy.bin", "algo": "sha256", "oid": "1234", "size": 100.0}},
+		{"key": "file", "value": map[string]any{"path": "config-copy.json", "encoding": "base64", "content": encode("{}")}},
+	}
+	assert.Equal(t, want, f.commitLines)
+
+	// Uploading again skips the LFS files already in the storage.
+	f.commitLines = nil
+	f.verified = nil
+	_, err = repo.UploadFolder(context.Background(), localDir, "models/", "")
+	require.NoError(t, err)
+	assert.Empty(t, f.verified)
+	require.Len(t, f.commitLines, 2)
+	assert.Equal(t, map[string]any{"path": "models/big.bin", "algo": "sha256", "oid": bigSHA256, "size": 41.0},
+		f.commitLines[1]["value"])
+}
+
+func TestCreateCommitLFSMissingObject(t *testing.T) {
+	f := newFakeHub(t)
+	repo := New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint(f.hub.URL).WithAuth("secret")
+	mediumContents := []byte("medium sized file, uploaded with LFS")
+	otherContents := []byte("another file, also uploaded with LFS")
+	f.omittedOID = sha256Hex(otherContents)
+
+	// An object left out of the batch response is an error, and no upload is started.
+	_, err := repo.CreateCommit(context.Background(), []CommitOperation{
+		&CommitOperationAdd{PathInRepo: "medium.bin", Content: mediumContents},
+		&CommitOperationAdd{PathInRepo: "other.bin", Content: otherContents},
+	}, "Add files")
+	require.ErrorContains(t, err, "other.bin")
+	assert.Empty(t, f.lfsObjects)
+	assert.Empty(t, f.commitLines)
+}
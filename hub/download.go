@@ -5,7 +5,7 @@ import (
 	"github.com/gomlx/go-huggingface/internal/downloader"
 	"github.com/gomlx/go-huggingface/internal/files"
 	"github.com/pkg/errors"
-	"log"
+	"log/slog"
 	"math/rand"
 	"os"
 	"path"
@@ -15,10 +15,35 @@ import (
 
 // Generic download utilities.
 
+// WithDownloadPriority returns a context that sets the priority of the downloads and requests made with it (e.g.
+// with Repo.DownloadFilesContext): when the download manager is at its limit of parallel downloads
+// (see Repo.MaxParallelDownload), those with higher priority go first. The default priority is 0.
+//
+// Files smaller than SmallFileSize (e.g.: "tokenizer_config.json") automatically get one more priority level, so
+// they don't wait behind the large files. And with the same priority, the downloads of Repos sharing a download
+// manager (see Repo.WithDownloadManager) take turns, so the many files of one Repo don't starve the others.
+func WithDownloadPriority(ctx context.Context, priority int) context.Context {
+	return downloader.WithPriority(ctx, priority)
+}
+
+// SmallFileSize is the size under which files get a higher download priority, see WithDownloadPriority.
+const SmallFileSize = 10 * 1024 * 1024
+
+// withFilePriority returns the context to download a file of the given size (if known) with: files smaller than
+// SmallFileSize get one more priority level than the one set in ctx (see WithDownloadPriority).
+func withFilePriority(ctx context.Context, size int64) context.Context {
+	if size <= 0 || size >= SmallFileSize {
+		return ctx
+	}
+	return downloader.WithPriority(ctx, downloader.ContextPriority(ctx)+1)
+}
+
 // getDownloadManager returns current downloader.Manager, or creates a new one for this Repo.
 func (r *Repo) getDownloadManager() *downloader.Manager {
 	if r.downloadManager == nil {
-		r.downloadManager = downloader.New().MaxParallel(r.MaxParallelDownload).WithAuthToken(r.authToken)
+		r.downloadManager = downloader.New().MaxParallel(r.MaxParallelDownload).WithAuthToken(r.authToken).
+			WithHTTPClient(r.httpClient).WithLogger(r.levelLogger().With("repo", r.ID)).
+			WithMetadataTimeout(r.etagTimeout).WithDownloadTimeout(r.downloadTimeout)
 	}
 	return r.downloadManager
 }
@@ -27,10 +52,15 @@ func (r *Repo) getDownloadManager() *downloader.Manager {
 //
 // If filePath exits and forceDownload is false, it is assumed to already have been correctly downloaded, and it will return immediately.
 //
-// It downloads the file to filePath+".tmp" and then atomically move it to filePath.
+// It downloads the file to filePath+".downloading" and then atomically move it to filePath.
+//
+// If opts.ETag or opts.SHA256 are set, the content is assumed to be immutable (e.g.: a blob named after its etag),
+// and an interrupted download is kept in filePath+".downloading", to be resumed in a later call.
+// Otherwise, any partial download is discarded.
+// If opts.SHA256 is set, the file is only moved to filePath if its contents match it.
 //
 // It uses a temporary filePath+".lock" to coordinate multiple processes/programs trying to download the same file at the same time.
-func (r *Repo) lockedDownload(ctx context.Context, url, filePath string, forceDownload bool, progressCallback downloader.ProgressCallback) error {
+func (r *Repo) lockedDownload(ctx context.Context, url, filePath string, forceDownload bool, opts downloader.DownloadOptions) error {
 	if files.Exists(filePath) {
 		if !forceDownload {
 			return nil
@@ -54,56 +84,46 @@ func (r *Repo) lockedDownload(ctx context.Context, url, filePath string, forceDo
 	// Lock file to avoid parallel downloads.
 	lockPath := filePath + ".lock"
 	var mainErr error
-	errLock := execOnFileLock(lockPath, func() {
+	logger := r.getLogger()
+	errLock := execOnFileLock(ctx, logger, lockPath, func() {
 		if files.Exists(filePath) {
 			// Some concurrent other process (or goroutine) already downloaded the file.
 			return
 		}
 
-		// Create tmpFile where to download.
-		var tmpFileClosed bool
+		// Temporary file where to download: it may hold a partial download from a previous attempt.
 		tmpPath := filePath + ".downloading"
-		tmpFile, err := os.Create(tmpPath)
-		if err != nil {
-			mainErr = errors.Wrapf(err, "creating temporary file for download in %q", tmpPath)
-			return
-		}
-		defer func() {
-			// If we exit with an error, make sure to close and remove unfinished temporary file.
-			if !tmpFileClosed {
-				err := tmpFile.Close()
-				if err != nil {
-					log.Printf("Failed closing temporary file %q: %v", tmpPath, err)
-				}
-				err = os.Remove(tmpPath)
-				if err != nil {
-					log.Printf("Failed removing temporary file %q: %v", tmpPath, err)
-				}
+		resumable := (opts.ETag != "" || opts.SHA256 != "") && !forceDownload
+		if !resumable {
+			if err := downloader.RemovePartialDownload(tmpPath); err != nil {
+				mainErr = errors.WithMessage(err, "failed to remove previous partial download")
+				return
 			}
-		}()
+		}
 
 		downloadManager := r.getDownloadManager()
-		mainErr = downloadManager.Download(ctx, url, tmpPath, progressCallback)
+		mainErr = asHTTPError(downloadManager.DownloadWithOptions(ctx, url, tmpPath, opts))
 		if mainErr != nil {
 			mainErr = errors.WithMessagef(mainErr, "while downloading %q to %q", url, tmpPath)
+			if !resumable {
+				// Partial download can't be resumed, so remove unfinished temporary file.
+				if err := downloader.RemovePartialDownload(tmpPath); err != nil {
+					logger.Warn("failed to remove temporary file", "file", tmpPath, "error", err)
+				}
+			}
 			return
 		}
 
 		// Download succeeded, move to our target location.
-		tmpFileClosed = true
-		if err := tmpFile.Close(); err != nil {
-			mainErr = errors.Wrapf(err, "failed to close temporary download file %q", tmpPath)
-			return
-		}
 		if err := os.Rename(tmpPath, filePath); err != nil {
 			mainErr = errors.Wrapf(err, "failed to move downloaded file %q to %q", tmpPath, filePath)
 			return
 		}
 
 		// File already exists, so we no longer need the lock file.
-		err = os.Remove(lockPath)
+		err := os.Remove(lockPath)
 		if err != nil {
-			log.Printf("Warning: error removing lock file %q: %+v", lockPath, err)
+			logger.Warn("failed to remove lock file", "file", lockPath, "error", err)
 		}
 	})
 	if mainErr != nil {
@@ -115,47 +135,45 @@ func (r *Repo) lockedDownload(ctx context.Context, url, filePath string, forceDo
 	return nil
 }
 
-// onFileLock opens the lockPath file (or creates if it doesn't yet exist), locks it, and executes the function.
-// If the lockPath is already locked, it polls with a 1 to 2 seconds period (randomly), until it acquires the lock.
+// execOnFileLock opens the lockPath file (or creates if it doesn't yet exist), locks it, and executes the function.
+// If the lockPath is already locked, it polls with a 1 to 2 seconds period (randomly), until it acquires the lock,
+// or until ctx is cancelled, in which case fn is not executed and the context error is returned.
+// Problems not returned as errors, and the waiting for the lock, are reported to logger.
 //
-// The lockPath is not removed. It's safe to remove it from the given fn, if one knows that no new calls to
-// execOnFileLock with the same lockPath is going to be made.
-func execOnFileLock(lockPath string, fn func()) (err error) {
+// The lockPath is not removed, but it's safe to remove it from the given fn: see tryLockFile.
+func execOnFileLock(ctx context.Context, logger *slog.Logger, lockPath string, fn func()) (err error) {
+	// Acquire lock or return an error if context is canceled (due to time out).
 	var f *os.File
-	f, err = os.OpenFile(lockPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, DefaultFileCreationPerm)
-	if err != nil {
-		err = errors.Wrapf(err, "while locking %q", lockPath)
-		return
-	}
-	defer func() {
-		err := f.Close()
+	var waiting bool
+	for {
+		f, err = tryLockFile(lockPath)
 		if err != nil {
-			log.Printf("failed to close lock file %q", lockPath)
+			return err
 		}
-	}()
-
-	// Acquire lock or return an error if context is canceled (due to time out).
-	for {
-		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
-		if err == nil {
+		if f != nil {
 			break
 		}
-		if !errors.Is(err, syscall.EAGAIN) {
-			err = errors.Wrapf(err, "while locking %q", lockPath)
-			return err
-		}
 
 		// Wait from 1 to 2 seconds.
-		time.Sleep(time.Millisecond * time.Duration(1000+rand.Intn(1000)))
+		if !waiting {
+			waiting = true
+			logger.DebugContext(ctx, "waiting for lock held by another program", "file", lockPath)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.WithMessagef(ctx.Err(), "while waiting for lock %q", lockPath)
+		case <-time.After(time.Millisecond * time.Duration(1000+rand.Intn(1000))):
+		}
 	}
 
 	// Setup clean up in a deferred function, so it happens even if `fn()` panics.
 	defer func() {
-		if err != nil {
-			err = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		errUnlock := syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		if errUnlock != nil && err == nil {
+			err = errors.Wrapf(errUnlock, "unlocking file %q", lockPath)
 		}
-		if err != nil {
-			err = errors.Wrapf(err, "unlocking file %q", lockPath)
+		if errClose := f.Close(); errClose != nil {
+			logger.Warn("failed to close lock file", "file", lockPath, "error", errClose)
 		}
 	}()
 
@@ -164,3 +182,115 @@ func execOnFileLock(lockPath string, fn func()) (err error) {
 
 	return
 }
+
+// tryLockFile opens the lockPath file (or creates if it doesn't yet exist) and locks it, without waiting. It returns
+// the locked file, or nil if the lock is held by another program (or another goroutine).
+//
+// Lock files are removed by their holders when they are no longer needed (see lockedDownload and
+// DeleteStrategy.Execute), so the lock acquired may be on a file already removed from lockPath, while another
+// program locks a new file created in its place. To make it safe, after locking it checks that the file is still
+// the one at lockPath, and otherwise it releases it and tries again.
+func tryLockFile(lockPath string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(lockPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, DefaultFileCreationPerm)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while locking %q", lockPath)
+		}
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err != nil {
+			_ = f.Close()
+			if errors.Is(err, syscall.EAGAIN) {
+				return nil, nil
+			}
+			return nil, errors.Wrapf(err, "while locking %q", lockPath)
+		}
+		lockedInfo, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, errors.Wrapf(err, "while locking %q", lockPath)
+		}
+		if currentInfo, err := os.Stat(lockPath); err == nil && os.SameFile(lockedInfo, currentInfo) {
+			return f, nil
+		}
+		// Closing the file releases the lock.
+		_ = f.Close()
+	}
+}
+
+// isFileLocked returns whether lockPath is currently locked (see execOnFileLock) by some process, including the
+// current one. It returns false if lockPath doesn't exist.
+func isFileLocked(lockPath string) bool {
+	f, err := os.Open(lockPath)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		return errors.Is(err, syscall.EAGAIN)
+	}
+	_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return false
+}
+
+// tryExecOnFileLock is like execOnFileLock, but it doesn't wait: if lockPath is already locked, it returns
+// immediately with acquired set to false, without executing fn.
+//
+// The lockPath is created if it doesn't exist, and it is not removed.
+func tryExecOnFileLock(logger *slog.Logger, lockPath string, fn func()) (acquired bool, err error) {
+	var f *os.File
+	f, err = tryLockFile(lockPath)
+	if err != nil || f == nil {
+		return
+	}
+	acquired = true
+	defer func() {
+		errUnlock := syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		if errUnlock != nil && err == nil {
+			err = errors.Wrapf(errUnlock, "unlocking file %q", lockPath)
+		}
+		if errClose := f.Close(); errClose != nil {
+			logger.Warn("failed to close lock file", "file", lockPath, "error", errClose)
+		}
+	}()
+	fn()
+	return
+}
+
+// tryExecOnFileLocks is like tryExecOnFileLock, but it executes fn holding the locks of all lockPaths. If any of them
+// is already locked, it returns immediately with inUse set to its path, without executing fn.
+//
+// The existing lock files are locked first: since locks in use always exist, if any of them is in use, no new
+// lock file is left behind.
+func tryExecOnFileLocks(logger *slog.Logger, lockPaths []string, fn func()) (inUse string, err error) {
+	ordered := make([]string, 0, len(lockPaths))
+	var missing []string
+	for _, lockPath := range lockPaths {
+		if files.Exists(lockPath) {
+			ordered = append(ordered, lockPath)
+		} else {
+			missing = append(missing, lockPath)
+		}
+	}
+	ordered = append(ordered, missing...)
+
+	var lockFrom func(ii int) (string, error)
+	lockFrom = func(ii int) (inUse string, err error) {
+		if ii == len(ordered) {
+			fn()
+			return "", nil
+		}
+		var innerErr error
+		acquired, err := tryExecOnFileLock(logger, ordered[ii], func() {
+			inUse, innerErr = lockFrom(ii + 1)
+		})
+		if err != nil {
+			return "", err
+		}
+		if !acquired {
+			return ordered[ii], nil
+		}
+		return inUse, innerErr
+	}
+	return lockFrom(0)
+}
@@ -0,0 +1,34 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecOnFileLockContext(t *testing.T) {
+	lockPath := path.Join(t.TempDir(), "file.lock")
+	require.NoError(t, execOnFileLock(context.Background(), slog.Default(), lockPath, func() {
+		// Lock is held: waiting for it is interrupted by the context.
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var executed bool
+		err := execOnFileLock(ctx, slog.Default(), lockPath, func() { executed = true })
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.False(t, executed)
+	}))
+}
+
+func TestWithFilePriority(t *testing.T) {
+	ctx := WithDownloadPriority(context.Background(), 5)
+	assert.Equal(t, 6, downloader.ContextPriority(withFilePriority(ctx, 1_000)))
+	assert.Equal(t, 5, downloader.ContextPriority(withFilePriority(ctx, SmallFileSize)))
+	assert.Equal(t, 5, downloader.ContextPriority(withFilePriority(ctx, 0))) // Unknown size.
+	assert.Equal(t, 1, downloader.ContextPriority(withFilePriority(context.Background(), 1_000)))
+}
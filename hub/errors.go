@@ -0,0 +1,128 @@
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/pkg/errors"
+)
+
+// ErrOfflineNotCached is returned (wrapped with more details) in offline mode (see Repo.WithOffline), when the
+// requested revision or file is not available in the cache.
+//
+// Use errors.Is(err, hub.ErrOfflineNotCached) to check for it.
+var ErrOfflineNotCached = errors.New("not available in the cache, and offline mode is enabled")
+
+// Errors returned by the HuggingFace Hub, wrapped in an *HTTPError with the details of the failed request.
+//
+// Use errors.Is to check for them, e.g.:
+//
+//	_, err := repo.DownloadFile("config.json")
+//	if errors.Is(err, hub.ErrGatedRepo) {
+//		fmt.Printf("Please accept the license of %q in https://huggingface.co/%s\n", repo.ID, repo.ID)
+//	}
+var (
+	// ErrRepositoryNotFound is returned if the repository doesn't exist, or if it is private and the authentication
+	// token (see Repo.WithAuth) is missing or has no access to it.
+	ErrRepositoryNotFound = errors.New("repository not found")
+
+	// ErrGatedRepo is returned if the repository is gated, and the user hasn't been granted access yet: usually
+	// the terms of use (e.g. the license) have to be accepted in the repository page.
+	ErrGatedRepo = errors.New("access to gated repository not granted")
+
+	// ErrRevisionNotFound is returned if the revision (branch, tag or commit-hash) doesn't exist in the repository.
+	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrEntryNotFound is returned if the file doesn't exist in the revision of the repository.
+	ErrEntryNotFound = errors.New("file not found in repository")
+
+	// ErrUnauthorized is returned if the authentication token is missing, invalid, or has no permission
+	// for the operation.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrRateLimited is returned if there were too many requests, even after retrying (see downloader.RetryPolicy).
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// HTTPError is returned (possibly wrapped) when a request to the HuggingFace Hub fails with one of the known
+// errors, like ErrRepositoryNotFound or ErrGatedRepo.
+//
+// Use errors.Is(err, hub.ErrGatedRepo) to check for a specific error, and errors.As to access the details.
+type HTTPError struct {
+	// Kind of the error: one of ErrRepositoryNotFound, ErrGatedRepo, ErrRevisionNotFound, ErrEntryNotFound,
+	// ErrUnauthorized or ErrRateLimited.
+	Kind error
+
+	// URL of the failed request.
+	URL string
+
+	// StatusCode of the response.
+	StatusCode int
+
+	// ErrorCode returned by the HuggingFace Hub in the "X-Error-Code" header, if any, e.g. "GatedRepo".
+	ErrorCode string
+
+	// Message returned by the HuggingFace Hub in the "X-Error-Message" header, if any.
+	Message string
+
+	// RetryAfter is the delay requested by the server before trying again, or 0 if not given.
+	RetryAfter time.Duration
+
+	// err is the original error.
+	err error
+}
+
+// Error implements the error interface.
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.err)
+}
+
+// Unwrap returns the original error.
+func (e *HTTPError) Unwrap() error {
+	return e.err
+}
+
+// Is returns whether target is the Kind of the error, so it can be used with errors.Is.
+func (e *HTTPError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// errorKinds maps the "X-Error-Code" returned by the HuggingFace Hub to the corresponding error.
+var errorKinds = map[string]error{
+	"RepoNotFound":     ErrRepositoryNotFound,
+	"GatedRepo":        ErrGatedRepo,
+	"RevisionNotFound": ErrRevisionNotFound,
+	"EntryNotFound":    ErrEntryNotFound,
+}
+
+// asHTTPError converts errors caused by an unexpected HTTP status code (downloader.StatusError) to an *HTTPError,
+// if it is one of the known kinds of errors, based on the "X-Error-Code" header, or on the status code otherwise.
+// Any other error is returned unchanged.
+func asHTTPError(err error) error {
+	var statusErr *downloader.StatusError
+	if err == nil || !errors.As(err, &statusErr) {
+		return err
+	}
+	kind := errorKinds[statusErr.ErrorCode]
+	if kind == nil {
+		switch statusErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			kind = ErrUnauthorized
+		case http.StatusTooManyRequests:
+			kind = ErrRateLimited
+		default:
+			return err
+		}
+	}
+	return &HTTPError{
+		Kind:       kind,
+		URL:        statusErr.URL,
+		StatusCode: statusErr.StatusCode,
+		ErrorCode:  statusErr.ErrorCode,
+		Message:    statusErr.Message,
+		RetryAfter: statusErr.RetryAfter,
+		err:        err,
+	}
+}
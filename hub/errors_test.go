@@ -0,0 +1,66 @@
+package hub
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/models/owner/missing/revision/main":
+			w.Header().Set("X-Error-Code", "RepoNotFound")
+			w.Header().Set("X-Error-Message", "Repository not found")
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/api/models/owner/gated/revision/main":
+			w.Header().Set("X-Error-Code", "GatedRepo")
+			w.Header().Set("X-Error-Message", "Access to model owner/gated is restricted.")
+			w.WriteHeader(http.StatusForbidden)
+		case "/api/models/owner/model/revision/v9":
+			w.Header().Set("X-Error-Code", "RevisionNotFound")
+			w.WriteHeader(http.StatusNotFound)
+		case "/api/models/owner/model/tree/main":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/api/models/owner/model/refs":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	newRepo := func(id string) *Repo {
+		return New(id).WithCacheDir(t.TempDir()).WithEndpoint(server.URL).
+			WithDownloadManager(downloader.New().WithRetryPolicy(downloader.RetryPolicy{}))
+	}
+	err := newRepo("owner/missing").DownloadInfo(false)
+	require.ErrorIs(t, err, ErrRepositoryNotFound)
+	var httpErr *HTTPError
+	require.True(t, stderrors.As(err, &httpErr))
+	assert.Equal(t, http.StatusUnauthorized, httpErr.StatusCode)
+	assert.Equal(t, "RepoNotFound", httpErr.ErrorCode)
+	assert.Equal(t, "Repository not found", httpErr.Message)
+
+	err = newRepo("owner/gated").DownloadInfo(false)
+	require.ErrorIs(t, err, ErrGatedRepo)
+	assert.NotErrorIs(t, err, ErrUnauthorized)
+
+	require.ErrorIs(t, newRepo("owner/model").WithRevision("v9").DownloadInfo(false), ErrRevisionNotFound)
+	for _, err = range newRepo("owner/model").IterTree("", false) {
+		require.ErrorIs(t, err, ErrUnauthorized)
+	}
+	_, err = newRepo("owner/model").ListRefs()
+	require.ErrorIs(t, err, ErrRateLimited)
+
+	// Unknown errors are not converted.
+	_, err = newRepo("owner/model").CreateRepo(context.Background(), false, false)
+	require.Error(t, err)
+	assert.False(t, stderrors.As(err, &httpErr))
+}
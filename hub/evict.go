@@ -0,0 +1,147 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gomlx/go-huggingface/internal/files"
+	"github.com/pkg/errors"
+)
+
+// evictionLockName is the name of the lock file, under the cache "<cacheDir>/.locks" directory, used to
+// serialize evictions by concurrent programs.
+const evictionLockName = "go-huggingface-eviction.lock"
+
+// EvictCache deletes the least-recently-used revisions (snapshots and their blobs) from cacheDir, until its size on
+// disk is at most maxBytes. Blobs not used by any snapshot are deleted first.
+//
+// Revisions containing any of the keep paths (files or snapshot directories), or with blobs locked by other programs
+// (e.g. being downloaded), are never evicted. So the cache may remain above maxBytes.
+//
+// It returns the number of bytes freed. Concurrent programs evicting the same cache are serialized with a lock file
+// in "<cacheDir>/.locks".
+func EvictCache(cacheDir string, maxBytes int64, keep ...string) (freed int64, err error) {
+	return evictCache(slog.Default(), cacheDir, maxBytes, keep...)
+}
+
+// evictCache implements EvictCache, reporting problems with the locks, and the waiting for them, to logger.
+func evictCache(logger *slog.Logger, cacheDir string, maxBytes int64, keep ...string) (freed int64, err error) {
+	cacheDir, err = files.ReplaceTildeInDir(cacheDir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to resolve directory %q", cacheDir)
+	}
+	locksDir := path.Join(cacheDir, ".locks")
+	if err = os.MkdirAll(locksDir, DefaultDirCreationPerm); err != nil {
+		return 0, errors.Wrapf(err, "while creating locks directory %q", locksDir)
+	}
+	lockPath := path.Join(locksDir, evictionLockName)
+	var mainErr error
+	errLock := execOnFileLock(context.Background(), logger, lockPath, func() {
+		var cache *CacheInfo
+		cache, mainErr = ScanCache(cacheDir)
+		if mainErr != nil {
+			return
+		}
+		strategy := cache.evictionStrategy(maxBytes, keep)
+		if strategy == nil {
+			return
+		}
+		freed, mainErr = strategy.execute(logger)
+	})
+	if mainErr != nil {
+		return freed, errors.WithMessagef(mainErr, "while evicting cache %q", cacheDir)
+	}
+	if errLock != nil {
+		return freed, errors.WithMessagef(errLock, "while locking %q to evict cache", lockPath)
+	}
+	return freed, nil
+}
+
+// evictionStrategy returns the strategy to bring the cache size to at most maxBytes, or nil if it is already
+// within the limit. See EvictCache.
+func (c *CacheInfo) evictionStrategy(maxBytes int64, keep []string) *DeleteStrategy {
+	if c.SizeOnDisk <= maxBytes {
+		return nil
+	}
+
+	// Orphan blobs go first.
+	strategy := &DeleteStrategy{}
+	for _, warning := range c.Warnings {
+		if warning.Kind != WarningOrphanBlob {
+			continue
+		}
+		if info, err := os.Stat(warning.Path); err == nil {
+			strategy.Blobs = append(strategy.Blobs, warning.Path)
+			strategy.ExpectedFreedSize += info.Size()
+		}
+	}
+
+	// Count the revisions using each blob, and list the candidate revisions for eviction.
+	type candidate struct {
+		repo     *CachedRepo
+		revision *CachedRevision
+	}
+	var candidates []candidate
+	blobUsers := make(map[string]int)
+	for _, repo := range c.Repos {
+		for _, revision := range repo.Revisions {
+			revisionBlobs := make(map[string]bool)
+			evictable := !containsAnyPath(revision.SnapshotPath, keep)
+			for _, file := range revision.Files {
+				if !revisionBlobs[file.BlobPath] {
+					revisionBlobs[file.BlobPath] = true
+					blobUsers[file.BlobPath]++
+				}
+				if evictable && (slices.Contains(keep, file.BlobPath) || isFileLocked(file.BlobPath+".lock")) {
+					evictable = false
+				}
+			}
+			if evictable {
+				candidates = append(candidates, candidate{repo, revision})
+			}
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return a.revision.LastAccessed.Compare(b.revision.LastAccessed)
+	})
+
+	// Evict least-recently-used revisions first, until within the limit.
+	for _, cand := range candidates {
+		if c.SizeOnDisk-strategy.ExpectedFreedSize <= maxBytes {
+			break
+		}
+		strategy.Snapshots = append(strategy.Snapshots, cand.revision.SnapshotPath)
+		for _, ref := range cand.revision.Refs {
+			strategy.Refs = append(strategy.Refs, path.Join(cand.repo.Path, "refs", ref))
+		}
+		evictedBlobs := make(map[string]bool)
+		for _, file := range cand.revision.Files {
+			if evictedBlobs[file.BlobPath] {
+				continue
+			}
+			evictedBlobs[file.BlobPath] = true
+			blobUsers[file.BlobPath]--
+			if blobUsers[file.BlobPath] == 0 {
+				strategy.Blobs = append(strategy.Blobs, file.BlobPath)
+				strategy.ExpectedFreedSize += file.Size
+			}
+		}
+	}
+	return strategy
+}
+
+// containsAnyPath returns whether any of the paths is dir itself or is inside dir.
+func containsAnyPath(dir string, paths []string) bool {
+	for _, p := range paths {
+		rel, err := filepath.Rel(dir, p)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package hub
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvictCache(t *testing.T) {
+	cacheDir := createTestCache(t)
+	cache, err := ScanCache(cacheDir)
+	require.NoError(t, err)
+	require.Equal(t, int64(26), cache.SizeOnDisk)
+	dataset, model := cache.Repos[0], cache.Repos[1]
+
+	// Make first revision of the model the least recently used.
+	now := time.Now()
+	for ii, revision := range model.Revisions {
+		for _, file := range revision.Files {
+			accessed := now.Add(time.Duration(ii-10) * time.Hour)
+			require.NoError(t, os.Chtimes(file.BlobPath, accessed, accessed))
+		}
+	}
+	oldest := now.Add(-100 * time.Hour)
+	datasetFile := dataset.Revisions[0].Files[0]
+	require.NoError(t, os.Chtimes(datasetFile.BlobPath, oldest, oldest))
+
+	// Within limits: nothing is evicted.
+	freed, err := EvictCache(cacheDir, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), freed)
+
+	// Orphan blob goes first, then the least-recently-used revision not kept.
+	freed, err = EvictCache(cacheDir, 15, datasetFile.FilePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6+10), freed)
+	cache, err = ScanCache(cacheDir)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), cache.SizeOnDisk)
+	require.Len(t, cache.Repos[0].Revisions, 1)
+	require.Len(t, cache.Repos[1].Revisions, 1)
+	assert.Equal(t, model.Revisions[1].CommitHash, cache.Repos[1].Revisions[0].CommitHash)
+	assert.FileExists(t, path.Join(model.Path, "blobs", "aaaa"))
+}
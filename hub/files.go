@@ -2,9 +2,7 @@ package hub
 
 import (
 	"context"
-	"fmt"
 	"iter"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -14,7 +12,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/dustin/go-humanize"
+	"github.com/gomlx/go-huggingface/internal/downloader"
 	"github.com/gomlx/go-huggingface/internal/files"
 	"github.com/pkg/errors"
 )
@@ -22,8 +20,13 @@ import (
 // IterFileNames iterate over the file names stored in the repo.
 // It doesn't trigger the downloading of the repo, only of the repo info.
 func (r *Repo) IterFileNames() iter.Seq2[string, error] {
+	return r.IterFileNamesContext(context.Background())
+}
+
+// IterFileNamesContext is like IterFileNames, but the download of the repo info can be cancelled with ctx.
+func (r *Repo) IterFileNamesContext(ctx context.Context) iter.Seq2[string, error] {
 	// Download info and files.
-	err := r.DownloadInfo(false)
+	err := r.DownloadInfoContext(ctx, false)
 	if err != nil {
 		// Error downloading: yield error only.
 		return func(yield func(string, error) bool) {
@@ -54,15 +57,15 @@ func (r *Repo) IterFileNames() iter.Seq2[string, error] {
 // If it fails, it simply return false.
 // Call Repo.DownloadInfo to handle errors downloading the info.
 func (r *Repo) HasFile(fileName string) bool {
-	if r.DownloadInfo(false) != nil {
+	return r.HasFileContext(context.Background(), fileName)
+}
+
+// HasFileContext is like HasFile, but the download of the repo info can be cancelled with ctx.
+func (r *Repo) HasFileContext(ctx context.Context, fileName string) bool {
+	if r.DownloadInfoContext(ctx, false) != nil {
 		return false
 	}
-	for _, si := range r.info.Siblings {
-		if si.Name == fileName {
-			return true
-		}
-	}
-	return false
+	return r.info.File(fileName) != nil
 }
 
 // cleanRelativeFilePath returns the repoFileName converted to the local OS separator, and by filtering out paths
@@ -83,7 +86,19 @@ func cleanRelativeFilePath(repoFileName string) string {
 //
 // The returned downloadPaths can be read, but shouldn't be modified, since there may be other programs using the same
 // files.
+//
+// If a cache limit is set (see Repo.WithCacheLimit), least-recently-used revisions are evicted after new files are
+// downloaded, except the ones being returned.
+//
+// Files already in the cache are returned without any HTTP requests. In offline mode (see Repo.WithOffline), if any
+// of the files is not in the cache, it returns an error wrapping ErrOfflineNotCached.
 func (r *Repo) DownloadFiles(repoFiles ...string) (downloadedPaths []string, err error) {
+	return r.DownloadFilesContext(context.Background(), repoFiles...)
+}
+
+// DownloadFilesContext is like DownloadFiles, but it can be cancelled with ctx: ongoing downloads are interrupted
+// (and kept to be resumed later), and it stops waiting for other programs downloading the same files.
+func (r *Repo) DownloadFilesContext(ctx context.Context, repoFiles ...string) (downloadedPaths []string, err error) {
 	if len(repoFiles) == 0 {
 		return nil, nil
 	}
@@ -100,7 +115,7 @@ func (r *Repo) DownloadFiles(repoFiles ...string) (downloadedPaths []string, err
 	_ = repoCacheDir
 
 	// Get snapshot dir:
-	snapshotDir, err := r.repoSnapshotsDir()
+	snapshotDir, err := r.repoSnapshotsDir(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -108,9 +123,12 @@ func (r *Repo) DownloadFiles(repoFiles ...string) (downloadedPaths []string, err
 	// Create context to stop any downloading of files if any error occur.
 	// The deferred cancel both cleans up the context, and also stops any pending/ongoing
 	// transfer that may be happening if an error occurs and the function exits.
-	ctx, cancelFn := context.WithCancel(context.Background())
+	ctx, cancelFn := context.WithCancel(ctx)
 	defer cancelFn()
 
+	// Downloads of different repositories sharing the download manager take turns (see WithDownloadPriority).
+	ctx = downloader.WithGroup(ctx, path.Join(string(r.repoType), r.ID))
+
 	// Store results.
 	downloadedPaths = make([]string, len(repoFiles))
 
@@ -118,46 +136,37 @@ func (r *Repo) DownloadFiles(repoFiles ...string) (downloadedPaths []string, err
 	var downloadingMu sync.Mutex
 	var firstError error
 	var requireDownload int // number of files that require download (and are not in cache yet).
-	perFileDownloaded := make([]uint64, len(repoFiles))
-	var allFilesDownloaded uint64
-	var numDownloadedFiles int
-	busyLoop := `-\|/`
-	busyLoopPos := 0
-	lastPrintTime := time.Now()
-
-	// Print downloading progress.
-	ratePrintFn := func() {
-		if firstError == nil {
-			fmt.Printf("\rDownloaded %d/%d files %c %s downloaded    ",
-				numDownloadedFiles, requireDownload, busyLoop[busyLoopPos], humanize.Bytes(allFilesDownloaded))
-		} else {
-			fmt.Printf("\rDownloaded %d/%d files, %s downloaded: error - %v     ",
-				numDownloadedFiles, requireDownload, humanize.Bytes(allFilesDownloaded),
-				firstError)
-		}
-		busyLoopPos = (busyLoopPos + 1) % len(busyLoop)
-		lastPrintTime = time.Now()
-	}
+	perFileDownloaded := make([]int64, len(repoFiles))
+	var allFilesDownloaded int64
+	reporter := r.getProgressReporter()
+	defer func() {
+		downloadingMu.Lock()
+		totalBytes := allFilesDownloaded
+		downloadingMu.Unlock()
+		reporter.Report(ProgressEvent{Kind: ProgressDone, Repo: r.ID, TotalBytes: totalBytes, Err: err})
+	}()
 
 	// Report error for a download, and interrupt everyone.
-	reportErrorFn := func(err error) {
+	reportErrorFn := func(repoFileName string, err error) {
 		downloadingMu.Lock()
-		if firstError == nil {
+		isFirst := firstError == nil
+		if isFirst {
 			firstError = err
 		}
 		cancelFn()
 		downloadingMu.Unlock()
-		return
+		if isFirst {
+			reporter.Report(ProgressEvent{Kind: ProgressError, Repo: r.ID, File: repoFileName, Err: err})
+		}
 	}
 
-	// Loop over each file to download.
-	var wg sync.WaitGroup
+	// Check all files before starting any download, so no download is left running if any of them fails.
+	type pendingFile struct {
+		idxFile                         int
+		repoFileName, snapshotPath, url string
+	}
+	var pendingFiles []pendingFile
 	for idxFile, repoFileName := range repoFiles {
-		fileURL, err := r.FileURL(repoFileName)
-		if err != nil {
-			return nil, err
-		}
-
 		// Join the path parts of fileName using the current OS separator.
 		relativeFilePath := cleanRelativeFilePath(repoFileName)
 		if relativeFilePath == "." {
@@ -167,14 +176,30 @@ func (r *Repo) DownloadFiles(repoFiles ...string) (downloadedPaths []string, err
 		downloadedPaths[idxFile] = snapshotPath // This is the file pointer we are returning.
 		if files.Exists(snapshotPath) {
 			// File already downloaded, skip.
+			reporter.Report(ProgressEvent{Kind: ProgressCacheHit, Repo: r.ID, File: repoFileName})
 			continue
 		}
+		if r.offline {
+			return nil, errors.WithMessagef(ErrOfflineNotCached, "file %q of repository %q (revision %q)",
+				repoFileName, r.ID, r.revision)
+		}
+		fileURL, err := r.fileURL(ctx, repoFileName)
+		if err != nil {
+			return nil, err
+		}
 
 		// Create directory for this individual file.
 		dir, _ := path.Split(snapshotPath)
 		if err = os.MkdirAll(dir, DefaultDirCreationPerm); err != nil {
 			return nil, errors.Wrapf(err, "while creating directory to download %q", snapshotPath)
 		}
+		pendingFiles = append(pendingFiles, pendingFile{idxFile, repoFileName, snapshotPath, fileURL})
+	}
+
+	// Loop over each file to download.
+	var wg sync.WaitGroup
+	for _, pending := range pendingFiles {
+		idxFile, repoFileName, snapshotPath, fileURL := pending.idxFile, pending.repoFileName, pending.snapshotPath, pending.url
 
 		// Start downloading in a separate goroutine.
 		wg.Add(1)
@@ -182,80 +207,119 @@ func (r *Repo) DownloadFiles(repoFiles ...string) (downloadedPaths []string, err
 			defer wg.Done()
 
 			// Download header of file for safety checks, and so we can find the blobPath.
-			header, contentLength, err := downloadManager.FetchHeader(ctx, fileURL)
+			// Redirects (e.g. to a CDN) are followed, but the authorization token is not sent to other hosts.
+			headerInfo, err := downloadManager.FetchHeader(ctx, fileURL)
 			if err != nil {
-				reportErrorFn(err)
+				reportErrorFn(repoFileName, asHTTPError(err))
 				return
 			}
-			metadata := extractFileMetadata(header, fileURL, contentLength)
+			metadata := extractFileMetadata(headerInfo, fileURL)
 			etag := metadata.ETag
 			if etag == "" {
-				reportErrorFn(errors.Errorf("resource %q for %q doesn't have an ETag, not able to ensure reproduceability",
+				reportErrorFn(repoFileName, errors.Errorf("resource %q for %q doesn't have an ETag, not able to ensure reproduceability",
 					repoFileName, r.ID))
 				return
 			}
-			if metadata.Location != fileURL {
-				// In the case of a redirect, remove authorization header when downloading blob
-				reportErrorFn(errors.Errorf("resource %q for %q has a redirect from %q to %q: this can be unsafe if we send our authorization token to the new URL",
-					repoFileName, r.ID, fileURL, metadata.Location))
-				return
-			}
 
 			// blobPath: download only if it has already been downloaded.
 			blobPath := path.Join(repoCacheDir, "blobs", etag)
 			if !files.Exists(blobPath) {
+				downloadingMu.Lock()
 				requireDownload++ // This file require download.
-				err := r.lockedDownload(ctx, fileURL, blobPath, false, func(downloadedBytes, totalBytes int64) {
+				downloadingMu.Unlock()
+				// Blobs are content addressed, so they can always be resumed: the ETag of the server serving the
+				// content (after redirects) is preferred to validate the resuming, since it may differ from the blob's etag.
+				//
+				// Notice we download from fileURL, and not from metadata.Location, because the redirect URLs
+				// may expire, and the download may be retried.
+				resumeETag := headerInfo.FinalHeader.Get("ETag")
+				if resumeETag == "" {
+					resumeETag = etag
+				}
+				// The size allows large files to be downloaded in parallel chunks.
+				opts := downloader.DownloadOptions{ETag: resumeETag, Size: int64(metadata.Size)}
+				if isSHA256(etag) {
+					// LFS files are named after their sha256: verify it while downloading.
+					opts.SHA256 = etag
+				}
+				// Progress of the file: the rate is measured from the first report, which may include bytes
+				// of a previous interrupted download.
+				fileTotal := int64(metadata.Size)
+				var fileStart, lastReport time.Time
+				var fileStartBytes int64
+				opts.Callback = func(downloadedBytes, totalBytes int64) {
 					// Execute at every report of download.
 					downloadingMu.Lock()
-					defer downloadingMu.Unlock()
-					lastReportedBytes := perFileDownloaded[idxFile]
-					newDownloaded := uint64(downloadedBytes) - lastReportedBytes
-					allFilesDownloaded += newDownloaded
-					perFileDownloaded[idxFile] = uint64(downloadedBytes)
-					if r.Verbosity > 0 && time.Since(lastPrintTime) > time.Second {
-						ratePrintFn()
+					allFilesDownloaded += downloadedBytes - perFileDownloaded[idxFile]
+					perFileDownloaded[idxFile] = downloadedBytes
+					downloadingMu.Unlock()
+
+					now := time.Now()
+					if fileStart.IsZero() {
+						fileStart, fileStartBytes = now, downloadedBytes
+					} else if now.Sub(lastReport) < progressReportInterval {
+						return
+					}
+					lastReport = now
+					if totalBytes > 0 {
+						fileTotal = totalBytes
 					}
-				})
+					event := ProgressEvent{Kind: ProgressDownloading, Repo: r.ID, File: repoFileName,
+						TotalBytes: fileTotal, DoneBytes: downloadedBytes}
+					if elapsed := now.Sub(fileStart).Seconds(); elapsed > 0 && downloadedBytes > fileStartBytes {
+						event.Rate = float64(downloadedBytes-fileStartBytes) / elapsed
+						if fileTotal > downloadedBytes {
+							event.ETA = time.Duration(float64(fileTotal-downloadedBytes) / event.Rate * float64(time.Second))
+						}
+					}
+					reporter.Report(event)
+				}
+				err := r.lockedDownload(withFilePriority(ctx, fileTotal), fileURL, blobPath, false, opts)
 				if err != nil {
-					reportErrorFn(err)
+					reportErrorFn(repoFileName, err)
 					return
 				}
-
-				// Done, print out progress.
-				numDownloadedFiles++
-				if r.Verbosity > 0 {
-					ratePrintFn()
+				if fileStart.IsZero() {
+					// Downloaded by another program, while waiting for the lock.
+					reporter.Report(ProgressEvent{Kind: ProgressCacheHit, Repo: r.ID, File: repoFileName})
+				} else {
+					reporter.Report(ProgressEvent{Kind: ProgressFileDone, Repo: r.ID, File: repoFileName,
+						TotalBytes: fileTotal, DoneBytes: fileTotal})
 				}
+			} else {
+				reporter.Report(ProgressEvent{Kind: ProgressCacheHit, Repo: r.ID, File: repoFileName})
 			}
 
 			// Link blob file to snapshot.
 			err = createSymLink(snapshotPath, blobPath)
 			if err != nil {
-				reportErrorFn(errors.WithMessagef(err, "while downloading %q from repository %q", repoFileName, r.ID))
+				reportErrorFn(repoFileName, errors.WithMessagef(err, "while downloading %q from repository %q", repoFileName, r.ID))
 			}
 		}()
 	}
 	wg.Wait()
-	if requireDownload > 0 {
-		if r.Verbosity > 0 {
-			if firstError != nil {
-				fmt.Println()
-			} else {
-				fmt.Printf("\rDownloaded %d/%d files, %s downloaded         \n",
-					numDownloadedFiles, requireDownload, humanize.Bytes(allFilesDownloaded))
-			}
-		}
-	}
 	if firstError != nil {
 		return nil, firstError
 	}
+	if r.cacheLimit > 0 && requireDownload > 0 {
+		// Evict least-recently-used files from the cache, except the ones being returned.
+		_, err = evictCache(r.getLogger(), r.cacheDir, r.cacheLimit, downloadedPaths...)
+		if err != nil {
+			r.getLogger().Warn("failed to evict cache", "cache_dir", r.cacheDir, "limit_bytes", r.cacheLimit,
+				"error", err)
+		}
+	}
 	return downloadedPaths, nil
 }
 
 // DownloadFile is a shortcut to DownloadFiles with only one file.
 func (r *Repo) DownloadFile(file string) (downloadedPath string, err error) {
-	res, err := r.DownloadFiles(file)
+	return r.DownloadFileContext(context.Background(), file)
+}
+
+// DownloadFileContext is a shortcut to DownloadFilesContext with only one file.
+func (r *Repo) DownloadFileContext(ctx context.Context, file string) (downloadedPath string, err error) {
+	res, err := r.DownloadFilesContext(ctx, file)
 	if err != nil {
 		return "", err
 	}
@@ -264,18 +328,27 @@ func (r *Repo) DownloadFile(file string) (downloadedPath string, err error) {
 
 // fileMetadata used by HuggingFace Hub.
 type fileMetadata struct {
-	CommitHash, ETag, Location string
-	Size                       int
+	CommitHash, ETag string
+
+	// Location is the final URL from where the file is served, after following redirects.
+	Location string
+
+	Size int
 }
 
-func extractFileMetadata(header http.Header, url string, contentLength int64) (metadata fileMetadata) {
+// extractFileMetadata from the headers returned by downloader.Manager.FetchHeader.
+//
+// Like huggingface_hub, the metadata is read from the first response (before redirects), since the
+// HuggingFace Hub returns the "X-Linked-Etag" and "X-Linked-Size" of the LFS files in it.
+func extractFileMetadata(headerInfo *downloader.HeaderInfo, url string) (metadata fileMetadata) {
+	header := headerInfo.Header
 	metadata.CommitHash = header.Get(HeaderXRepoCommit)
 	metadata.ETag = header.Get(HeaderXLinkedETag)
 	if metadata.ETag == "" {
 		metadata.ETag = header.Get("ETag")
 	}
 	metadata.ETag = removeQuotes(metadata.ETag)
-	metadata.Location = header.Get("Location")
+	metadata.Location = headerInfo.FinalURL
 	if metadata.Location == "" {
 		metadata.Location = url
 	}
@@ -287,12 +360,25 @@ func extractFileMetadata(header http.Header, url string, contentLength int64) (m
 			metadata.Size = 0
 		}
 	}
-	if metadata.Size == 0 {
-		metadata.Size = int(contentLength)
+	if metadata.Size == 0 && headerInfo.ContentLength > 0 {
+		metadata.Size = int(headerInfo.ContentLength)
 	}
 	return
 }
 
+// isSHA256 returns whether etag has the format of a hex encoded SHA-256 hash, as used by LFS files.
+func isSHA256(etag string) bool {
+	if len(etag) != 64 {
+		return false
+	}
+	for _, c := range etag {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
 func removeQuotes(str string) string {
 	return strings.TrimRight(strings.TrimLeft(str, "\""), "\"")
 }
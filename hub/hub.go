@@ -75,14 +75,23 @@ func getEnvOr(key, defaultValue string) string {
 	return v
 }
 
+// isTrue returns whether the value of an environment variable is considered true, with the same rules as
+// huggingface_hub: one of "1", "ON", "YES" or "TRUE" (case-insensitive).
+func isTrue(value string) bool {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "1", "ON", "YES", "TRUE":
+		return true
+	}
+	return false
+}
+
 // DefaultCacheDir for HuggingFace Hub, same used by the python library.
 //
-// Its prefix is either `${XDG_CACHE_HOME}` if set, or `~/.cache` otherwise. Followed by `/huggingface/hub/`.
+// It is `${HF_HUB_CACHE}` or `${HUGGINGFACE_HUB_CACHE}` if set. Otherwise, it is `hub/` under the huggingface_hub
+// home directory: `${HF_HOME}` if set, or `huggingface/` under `${XDG_CACHE_HOME}` or `~/.cache`.
 // So typically: `~/.cache/huggingface/hub/`.
 func DefaultCacheDir() string {
-	cacheDir := getEnvOr("XDG_CACHE_HOME", path.Join(os.Getenv("HOME"), ".cache"))
-	cacheDir = path.Join(cacheDir, "huggingface", "hub")
-	return cacheDir
+	return expandHome(getEnvOr("HF_HUB_CACHE", getEnvOr("HUGGINGFACE_HUB_CACHE", path.Join(defaultHome(), "hub"))))
 }
 
 // DefaultHttpUserAgent returns a user agent to use with HuggingFace Hub API.
@@ -5,10 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
+	"time"
 
+	"github.com/gomlx/go-huggingface/internal/downloader"
 	"github.com/gomlx/go-huggingface/internal/files"
 	"github.com/pkg/errors"
 )
@@ -16,7 +19,7 @@ import (
 // RepoInfo holds information about a HuggingFace repo, it is the json served when hitting the URL
 // https://huggingface.co/api/<repo_type>/<model_id>
 //
-// TODO: Not complete, only holding the fields used so far by the library.
+// Some fields are only filled for some types of repositories (e.g.: LibraryName is only set for models).
 type RepoInfo struct {
 	ID          string          `json:"id"`
 	ModelID     string          `json:"model_id"`
@@ -25,11 +28,72 @@ type RepoInfo struct {
 	Tags        []string        `json:"tags"`
 	Siblings    []*FileInfo     `json:"siblings"`
 	SafeTensors SafeTensorsInfo `json:"safetensors"`
+
+	Private  bool      `json:"private"`
+	Gated    GatedMode `json:"gated"`
+	Disabled bool      `json:"disabled"`
+
+	Downloads    int       `json:"downloads"`
+	Likes        int       `json:"likes"`
+	LastModified time.Time `json:"lastModified"`
+	CreatedAt    time.Time `json:"createdAt"`
+
+	LibraryName string `json:"library_name"`
+	PipelineTag string `json:"pipeline_tag"`
+
+	// CardData holds the metadata in the header of the repository card (README.md).
+	CardData map[string]any `json:"cardData"`
+
+	// Config holds the model configuration summary (e.g.: "architectures", "model_type").
+	Config map[string]any `json:"config"`
+
+	// Spaces using the model.
+	Spaces []string `json:"spaces"`
+
+	TransformersInfo *TransformersInfo `json:"transformersInfo"`
 }
 
 // FileInfo represents one of the model file, in the Info structure.
 type FileInfo struct {
 	Name string `json:"rfilename"`
+
+	// Size of the file in bytes.
+	Size int64 `json:"size"`
+
+	// BlobID is the git hash of the file (or of its LFS pointer file).
+	BlobID string `json:"blobId"`
+
+	// LFS information, only set if the file is stored with git LFS.
+	LFS *LFSInfo `json:"lfs"`
+}
+
+// LFSInfo holds the information about a file stored with git LFS.
+type LFSInfo struct {
+	// SHA256 of the file contents, hex encoded. It's also the file's ETag.
+	SHA256 string `json:"sha256"`
+
+	// Size of the file in bytes.
+	Size int64 `json:"size"`
+
+	// PointerSize is the size of the LFS pointer file stored in git.
+	PointerSize int64 `json:"pointerSize"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler: the tree API (see Repo.IterTree) returns the SHA256 as "oid".
+func (l *LFSInfo) UnmarshalJSON(data []byte) error {
+	type plainLFSInfo LFSInfo
+	var aux struct {
+		plainLFSInfo
+		OID string `json:"oid"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*l = LFSInfo(aux.plainLFSInfo)
+	if l.SHA256 == "" {
+		l.SHA256 = aux.OID
+	}
+	return nil
 }
 
 // SafeTensorsInfo holds counts on number of parameters of various types.
@@ -40,6 +104,67 @@ type SafeTensorsInfo struct {
 	Parameters map[string]int
 }
 
+// TransformersInfo holds information on how to use the model with the transformers python library.
+type TransformersInfo struct {
+	AutoModel   string `json:"auto_model"`
+	CustomClass string `json:"custom_class"`
+	PipelineTag string `json:"pipeline_tag"`
+	Processor   string `json:"processor"`
+}
+
+// GatedMode of a repository: empty if the repository is not gated, or "auto" or "manual", depending on how the
+// access requests are approved.
+type GatedMode string
+
+// UnmarshalJSON implements json.Unmarshaler: HuggingFace Hub returns false for repositories not gated, and
+// true is taken as "auto".
+func (g *GatedMode) UnmarshalJSON(data []byte) error {
+	var gated bool
+	if err := json.Unmarshal(data, &gated); err == nil {
+		*g = ""
+		if gated {
+			*g = "auto"
+		}
+		return nil
+	}
+	var mode string
+	if err := json.Unmarshal(data, &mode); err != nil {
+		return errors.Wrapf(err, "invalid value for gated: %s", data)
+	}
+	*g = GatedMode(mode)
+	return nil
+}
+
+// File returns the FileInfo for the given file name, or nil if the repository has no such file.
+func (info *RepoInfo) File(fileName string) *FileInfo {
+	for _, si := range info.Siblings {
+		if si.Name == fileName {
+			return si
+		}
+	}
+	return nil
+}
+
+// TotalSize returns the sum of the sizes of the given files in bytes, or of all files if none are given.
+// It can be used to check for the disk space needed before downloading.
+//
+// Files not in the repository are ignored.
+func (info *RepoInfo) TotalSize(fileNames ...string) int64 {
+	var total int64
+	if len(fileNames) == 0 {
+		for _, si := range info.Siblings {
+			total += si.Size
+		}
+		return total
+	}
+	for _, fileName := range fileNames {
+		if si := info.File(fileName); si != nil {
+			total += si.Size
+		}
+	}
+	return total
+}
+
 // Info returns the RepoInfo structure about the model.
 // Most users don't need to call this directly, instead use the various iterators.
 //
@@ -51,29 +176,45 @@ func (r *Repo) Info() *RepoInfo {
 	if r.info == nil {
 		err := r.DownloadInfo(false)
 		if err != nil {
-			log.Printf("Error while downloading info about Repo: %+v", err)
+			r.getLogger().Error("failed to download repository info", "error", err)
 		}
 	}
 	return r.info
 }
 
-// infoURL for the API that returns the info about a repository.
+// infoURL for the API that returns the info about a repository, including the size and LFS information of the files.
 func (r *Repo) infoURL() string {
-	return fmt.Sprintf("%s/api/%s/%s/revision/%s", r.hfEndpoint, r.repoType, r.ID, r.revision)
+	return fmt.Sprintf("%s/api/%s/%s/revision/%s?blobs=true", r.hfEndpoint, r.repoType, r.ID, r.revision)
 }
 
 // DownloadInfo about the model, if it hasn't yet.
 //
-// It will attempt to use the "_info_.json" file in the cache directory first.
+// It will attempt to use the "info/<revision>" file in the cache directory first. When the info is downloaded,
+// the "refs/<revision>" file (used by huggingface_hub to resolve revisions) is also updated with its commit-hash.
 //
 // If forceDownload is set to true, it ignores the current info or the cached one, and download it again from HuggingFace.
 //
 // See Repo.Info to access the Info directory.
 // Most users don't need to call this directly, instead use the various iterators.
+//
+// In offline mode (see Repo.WithOffline), it only uses the cache: if the info file is not available, a minimal
+// RepoInfo is built from the snapshot of the revision, listing only the files already cached.
 func (r *Repo) DownloadInfo(forceDownload bool) error {
+	return r.DownloadInfoContext(context.Background(), forceDownload)
+}
+
+// DownloadInfoContext is like DownloadInfo, but it can be cancelled with ctx, including while waiting for other
+// programs downloading the same info.
+func (r *Repo) DownloadInfoContext(ctx context.Context, forceDownload bool) error {
 	if r.info != nil && !forceDownload {
 		return nil
 	}
+	if r.offline {
+		if forceDownload {
+			return errors.Errorf("cannot force the download of the info of repository %q in offline mode", r.ID)
+		}
+		return r.loadCachedInfo()
+	}
 
 	// Create directory and file path for the info file.
 	infoFilePath, err := r.repoCacheDir()
@@ -87,13 +228,42 @@ func (r *Repo) DownloadInfo(forceDownload bool) error {
 	infoFilePath = path.Join(infoFilePath, r.revision)
 
 	// Download info file if needed.
+	downloaded := false
 	if !files.Exists(infoFilePath) || forceDownload {
-		err := r.lockedDownload(context.Background(), r.infoURL(), infoFilePath, forceDownload, nil)
+		err := r.lockedDownload(ctx, r.infoURL(), infoFilePath, forceDownload, downloader.DownloadOptions{})
+		if err != nil {
+			return errors.WithMessagef(err, "failed to download repository info")
+		}
+		downloaded = true
+	}
+	if err = r.readInfoFile(infoFilePath); err != nil {
+		return err
+	}
+
+	// The "refs/<revision>" file (possibly updated by another program) points to a different commit than the
+	// cached info: the info is stale, so it is downloaded again.
+	commitHash, found := r.readRef()
+	if !downloaded && found && commitHash != r.info.CommitHash {
+		err := r.lockedDownload(ctx, r.infoURL(), infoFilePath, true, downloader.DownloadOptions{})
 		if err != nil {
 			return errors.WithMessagef(err, "failed to download repository info")
 		}
+		if err = r.readInfoFile(infoFilePath); err != nil {
+			return err
+		}
 	}
 
+	// Update the "refs/<revision>" file, used to resolve the revision to a commit-hash, if needed.
+	if !found || commitHash != r.info.CommitHash {
+		if err = r.writeRef(r.info.CommitHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readInfoFile parses the info file previously downloaded to infoFilePath, and sets it as the Repo info.
+func (r *Repo) readInfoFile(infoFilePath string) error {
 	// Read _info_.json from disk.
 	infoJson, err := os.ReadFile(infoFilePath)
 	if err != nil {
@@ -110,3 +280,76 @@ func (r *Repo) DownloadInfo(forceDownload bool) error {
 	r.info = newInfo
 	return nil
 }
+
+// loadCachedInfo loads the info of the repository from the cache, without any HTTP requests.
+//
+// If the info file for the revision is not in the cache, or if it is for a different commit than the one in
+// "refs/<revision>", it builds a RepoInfo from the snapshot of the revision, with only the files already in the cache.
+func (r *Repo) loadCachedInfo() error {
+	repoCacheDir := r.RepoCacheDir()
+	infoFilePath := path.Join(repoCacheDir, "info", r.revision)
+	commitHash, err := r.cachedCommitHash()
+	if files.Exists(infoFilePath) {
+		if errInfo := r.readInfoFile(infoFilePath); errInfo != nil {
+			return errInfo
+		}
+		if err != nil || r.info.CommitHash == commitHash {
+			return nil
+		}
+		// The "refs/<revision>" file (possibly updated by another program) points to a different commit, with
+		// a snapshot in the cache: use it instead.
+		r.info = nil
+	}
+	if err != nil {
+		return err
+	}
+	snapshotDir := path.Join(repoCacheDir, "snapshots", commitHash)
+	newInfo := &RepoInfo{ID: r.ID, CommitHash: commitHash}
+	err = filepath.WalkDir(snapshotDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(snapshotDir, filePath)
+		if err != nil {
+			return err
+		}
+		newInfo.Siblings = append(newInfo.Siblings, &FileInfo{Name: filepath.ToSlash(relPath)})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list cached files of repository %q in %q", r.ID, snapshotDir)
+	}
+	r.info = newInfo
+	return nil
+}
+
+// cachedCommitHash resolves the revision to a commit-hash using only the cache: either from the "refs/<revision>"
+// file, or the revision is itself a commit-hash with a snapshot directory.
+//
+// It returns an error wrapping ErrOfflineNotCached if the revision can't be resolved.
+func (r *Repo) cachedCommitHash() (string, error) {
+	repoCacheDir := r.RepoCacheDir()
+	if commitHash, found := r.readRef(); found && files.Exists(path.Join(repoCacheDir, "snapshots", commitHash)) {
+		return commitHash, nil
+	}
+	if isCommitHash(r.revision) && files.Exists(path.Join(repoCacheDir, "snapshots", r.revision)) {
+		return r.revision, nil
+	}
+	return "", errors.WithMessagef(ErrOfflineNotCached, "revision %q of repository %q", r.revision, r.ID)
+}
+
+// isCommitHash returns whether the revision has the format of a git commit-hash: 40 hex digits.
+func isCommitHash(revision string) bool {
+	if len(revision) != 40 {
+		return false
+	}
+	for _, c := range revision {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
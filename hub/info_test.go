@@ -0,0 +1,192 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffline(t *testing.T) {
+	// Endpoint is invalid, so any HTTP request would fail.
+	repo := New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint("http://invalid.invalid").WithOffline(true)
+	repoCacheDir := repo.RepoCacheDir()
+	const commitHash = "0123456789abcdef0123456789abcdef01234567"
+
+	// Revision not in cache.
+	err := repo.DownloadInfo(false)
+	require.ErrorIs(t, err, ErrOfflineNotCached)
+
+	// Cached file, with refs/main pointing to the snapshot.
+	_, snapshotPath := writeTestBlob(t, repoCacheDir, commitHash, "sub/config.json",
+		"d7edf6bd2a681fb0175f7735299831ee1b22b812", []byte("{}"))
+	require.NoError(t, os.MkdirAll(path.Join(repoCacheDir, "refs"), DefaultDirCreationPerm))
+	require.NoError(t, os.WriteFile(path.Join(repoCacheDir, "refs", "main"), []byte(commitHash), DefaultFileCreationPerm))
+
+	require.NoError(t, repo.DownloadInfo(false))
+	assert.Equal(t, commitHash, repo.Info().CommitHash)
+	assert.True(t, repo.HasFile("sub/config.json"))
+	downloadedPath, err := repo.DownloadFile("sub/config.json")
+	require.NoError(t, err)
+	assert.Equal(t, snapshotPath, downloadedPath)
+
+	_, err = repo.DownloadFile("model.safetensors")
+	require.ErrorIs(t, err, ErrOfflineNotCached)
+
+	// Revision given as a commit-hash.
+	repo = New("owner/model").WithCacheDir(repo.cacheDir).WithOffline(true).WithRevision(commitHash)
+	require.NoError(t, repo.DownloadInfo(false))
+	assert.Equal(t, commitHash, repo.Info().CommitHash)
+}
+
+func TestRefs(t *testing.T) {
+	const commitHash = "0123456789abcdef0123456789abcdef01234567"
+	var numRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numRequests++
+		assert.Equal(t, "/api/models/owner/model/revision/main", r.URL.Path)
+		_, _ = fmt.Fprintf(w, `{"id": "owner/model", "sha": %q, "siblings": [{"rfilename": "config.json"}]}`, commitHash)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	repo := New("owner/model").WithCacheDir(cacheDir).WithEndpoint(server.URL)
+	require.NoError(t, repo.DownloadInfo(false))
+	assert.Equal(t, 1, numRequests)
+	contents, err := os.ReadFile(path.Join(repo.RepoCacheDir(), "refs", "main"))
+	require.NoError(t, err)
+	assert.Equal(t, commitHash, string(contents))
+
+	// Online, if "refs/main" was changed by another program, the cached info is stale: it is downloaded again,
+	// and "refs/main" is updated.
+	const otherCommitHash = "1111111111111111111111111111111111111111"
+	refPath := path.Join(repo.RepoCacheDir(), "refs", "main")
+	require.NoError(t, os.WriteFile(refPath, []byte(otherCommitHash), DefaultFileCreationPerm))
+	repo = New("owner/model").WithCacheDir(cacheDir).WithEndpoint(server.URL)
+	got, err := repo.readCommitHashForRevision(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, commitHash, got)
+	assert.Equal(t, repo.Info().CommitHash, got)
+	assert.Equal(t, 2, numRequests)
+	contents, err = os.ReadFile(refPath)
+	require.NoError(t, err)
+	assert.Equal(t, commitHash, string(contents))
+
+	// Online, a missing "refs/main" is written from the cached info, without downloading it again.
+	require.NoError(t, os.Remove(refPath))
+	repo = New("owner/model").WithCacheDir(cacheDir).WithEndpoint(server.URL)
+	got, err = repo.readCommitHashForRevision(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, commitHash, got)
+	assert.Equal(t, 2, numRequests)
+	contents, err = os.ReadFile(refPath)
+	require.NoError(t, err)
+	assert.Equal(t, commitHash, string(contents))
+
+	// Offline, "refs/main" is used, if its snapshot is in the cache.
+	require.NoError(t, os.WriteFile(refPath, []byte(otherCommitHash), DefaultFileCreationPerm))
+	require.NoError(t, os.MkdirAll(path.Join(repo.RepoCacheDir(), "snapshots", otherCommitHash), DefaultDirCreationPerm))
+	repo = New("owner/model").WithCacheDir(cacheDir).WithOffline(true)
+	got, err = repo.readCommitHashForRevision(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, otherCommitHash, got)
+	assert.Equal(t, repo.Info().CommitHash, got)
+}
+
+func TestRepoInfoJSON(t *testing.T) {
+	infoJSON := `{
+  "_id": "66a8b5e3d9bbab5c8b9d9e9e",
+  "id": "google/gemma-2-2b-it",
+  "private": false,
+  "pipeline_tag": "text-generation",
+  "library_name": "transformers",
+  "tags": ["transformers", "safetensors"],
+  "downloads": 123456,
+  "likes": 789,
+  "author": "google",
+  "sha": "299a8560bedf22ed1c72a8a11e7dce4a7f9f51f8",
+  "lastModified": "2024-08-27T19:41:44.000Z",
+  "createdAt": "2024-07-16T16:19:44.000Z",
+  "gated": "manual",
+  "disabled": false,
+  "cardData": {"license": "gemma", "library_name": "transformers"},
+  "config": {"architectures": ["Gemma2ForCausalLM"], "model_type": "gemma2"},
+  "transformersInfo": {"auto_model": "AutoModelForCausalLM", "pipeline_tag": "text-generation", "processor": "AutoTokenizer"},
+  "spaces": ["someone/space"],
+  "siblings": [
+    {"rfilename": "config.json", "blobId": "d7edf6bd2a681fb0175f7735299831ee1b22b812", "size": 838},
+    {"rfilename": "model.safetensors", "blobId": "abcd", "size": 5228717512,
+     "lfs": {"sha256": "403450e234d65943a7dcf7e05a771ce3c92faa84dd07db4ac20f592037a1e4bd", "size": 5228717512, "pointerSize": 135}}
+  ],
+  "safetensors": {"parameters": {"BF16": 2614341888}, "total": 2614341888}
+}`
+	info := &RepoInfo{}
+	require.NoError(t, json.Unmarshal([]byte(infoJSON), info))
+	assert.Equal(t, GatedMode("manual"), info.Gated)
+	assert.Equal(t, 123456, info.Downloads)
+	assert.Equal(t, 2024, info.LastModified.Year())
+	assert.Equal(t, "transformers", info.LibraryName)
+	assert.Equal(t, "text-generation", info.PipelineTag)
+	assert.Equal(t, "gemma", info.CardData["license"])
+	assert.Equal(t, "gemma2", info.Config["model_type"])
+	assert.Equal(t, "AutoModelForCausalLM", info.TransformersInfo.AutoModel)
+	assert.Equal(t, []string{"someone/space"}, info.Spaces)
+	assert.Equal(t, 2614341888, info.SafeTensors.Total)
+	assert.Nil(t, info.File("config.json").LFS)
+	lfs := info.File("model.safetensors").LFS
+	require.NotNil(t, lfs)
+	assert.Equal(t, int64(135), lfs.PointerSize)
+	assert.Equal(t, int64(838+5228717512), info.TotalSize())
+	assert.Equal(t, int64(838), info.TotalSize("config.json", "missing"))
+
+	require.NoError(t, json.Unmarshal([]byte(`{"gated": false}`), info))
+	assert.Equal(t, GatedMode(""), info.Gated)
+	require.NoError(t, json.Unmarshal([]byte(`{"gated": true}`), info))
+	assert.Equal(t, GatedMode("auto"), info.Gated)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	// No network: all requests are served by the transport.
+	const commitHash = "0123456789abcdef0123456789abcdef01234567"
+	var requestedURLs []string
+	client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requestedURLs = append(requestedURLs, req.URL.String())
+		recorder := httptest.NewRecorder()
+		_, _ = fmt.Fprintf(recorder, `{"id": "owner/model", "sha": %q}`, commitHash)
+		return recorder.Result(), nil
+	})}
+	repo := New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint("https://hub.internal").WithHTTPClient(client)
+	require.NoError(t, repo.DownloadInfo(false))
+	assert.Equal(t, commitHash, repo.Info().CommitHash)
+	assert.Equal(t, []string{"https://hub.internal/api/models/owner/model/revision/main?blobs=true"}, requestedURLs)
+
+	// A shared download manager is not changed by the Repo: its own client is used.
+	requestedURLs = nil
+	var sharedURLs []string
+	sharedClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sharedURLs = append(sharedURLs, req.URL.String())
+		recorder := httptest.NewRecorder()
+		_, _ = fmt.Fprintf(recorder, `{"id": "owner/model", "sha": %q}`, commitHash)
+		return recorder.Result(), nil
+	})}
+	repo = New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint("https://hub.internal").
+		WithDownloadManager(downloader.New().WithHTTPClient(sharedClient)).WithHTTPClient(client)
+	require.NoError(t, repo.DownloadInfo(false))
+	assert.Empty(t, requestedURLs)
+	assert.Len(t, sharedURLs, 1)
+}
+
+// roundTripperFunc implements http.RoundTripper with a function.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,280 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/pkg/errors"
+)
+
+// lfsBatchSize is the maximum number of objects in each call to the LFS batch API, the same used by huggingface_hub.
+const lfsBatchSize = 256
+
+// lfsHeader is set in the requests to the LFS batch API, as required by the git LFS protocol.
+var lfsHeader = http.Header{
+	"Accept":       {"application/vnd.git-lfs+json"},
+	"Content-Type": {"application/vnd.git-lfs+json"},
+}
+
+// lfsAction is an action to be taken for an LFS object, as returned by the LFS batch API.
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// lfsBatchObject is an object in the response of the LFS batch API.
+type lfsBatchObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+
+	// Actions are not set if the object is already in the LFS storage.
+	Actions struct {
+		Upload *lfsAction `json:"upload"`
+		Verify *lfsAction `json:"verify"`
+	} `json:"actions"`
+
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// uploadLFSFiles uploads the files to the LFS storage of the repository, using the git LFS batch API.
+// Files already in the storage are skipped.
+//
+// Files are uploaded in parallel, limited by the download manager (see Repo.WithDownloadManager).
+func (r *Repo) uploadLFSFiles(ctx context.Context, lfsFiles []*commitFile) error {
+	batchURL := r.repoURL() + ".git/info/lfs/objects/batch"
+	for start := 0; start < len(lfsFiles); start += lfsBatchSize {
+		batch := lfsFiles[start:min(start+lfsBatchSize, len(lfsFiles))]
+		type lfsObject struct {
+			OID  string `json:"oid"`
+			Size int64  `json:"size"`
+		}
+		request := struct {
+			Operation string      `json:"operation"`
+			Transfers []string    `json:"transfers"`
+			Objects   []lfsObject `json:"objects"`
+			HashAlgo  string      `json:"hash_algo"`
+			Ref       struct {
+				Name string `json:"name"`
+			} `json:"ref"`
+		}{Operation: "upload", Transfers: []string{"basic", "multipart"}, HashAlgo: "sha256"}
+		request.Ref.Name = r.revision
+		bySHA256 := make(map[string]*commitFile, len(batch))
+		for _, cf := range batch {
+			request.Objects = append(request.Objects, lfsObject{OID: cf.sha256, Size: cf.size})
+			bySHA256[cf.sha256] = cf
+		}
+		body, err := json.Marshal(&request)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode LFS batch request")
+		}
+		var response struct {
+			Transfer string            `json:"transfer"`
+			Objects  []*lfsBatchObject `json:"objects"`
+		}
+		err = sendAPI(ctx, r, &downloader.Request{
+			Method: http.MethodPost, URL: batchURL, Header: lfsHeader, Body: bytes.NewReader(body),
+			Retryable: true, // It only requests the upload actions.
+		}, &response)
+		if err != nil {
+			return err
+		}
+
+		// Check all objects before starting any upload, so no upload is left running if any of them fails.
+		toUpload := make(map[*lfsBatchObject]*commitFile, len(response.Objects))
+		returned := make(map[string]bool, len(response.Objects))
+		for _, object := range response.Objects {
+			cf, found := bySHA256[object.OID]
+			if !found {
+				return errors.Errorf("LFS batch API returned unknown object %q", object.OID)
+			}
+			if object.Error != nil {
+				return errors.Errorf("LFS batch API returned error %d for file %q: %s",
+					object.Error.Code, cf.op.PathInRepo, object.Error.Message)
+			}
+			returned[object.OID] = true
+			if object.Actions.Upload != nil {
+				toUpload[object] = cf
+			}
+			// Otherwise, it's already in the LFS storage.
+		}
+		for _, cf := range batch {
+			if !returned[cf.sha256] {
+				return errors.Errorf("LFS batch API didn't return object %q for file %q", cf.sha256, cf.op.PathInRepo)
+			}
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var errs []error
+		for object, cf := range toUpload {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := r.uploadLFSObject(ctx, cf, object); err != nil {
+					mu.Lock()
+					errs = append(errs, errors.WithMessagef(asHTTPError(err), "while uploading %q", cf.op.PathInRepo))
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if len(errs) > 0 {
+			return stderrors.Join(errs...)
+		}
+	}
+	return nil
+}
+
+// uploadLFSObject uploads one file to the LFS storage, in one request or in multiple parts if the server asks for it,
+// and then verifies it, if requested.
+func (r *Repo) uploadLFSObject(ctx context.Context, cf *commitFile, object *lfsBatchObject) error {
+	reader, err := cf.op.open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	upload := object.Actions.Upload
+	if _, found := upload.Header["chunk_size"]; found {
+		err = r.uploadLFSMultipart(ctx, cf, upload, reader)
+	} else {
+		_, _, err = r.getDownloadManager().Send(ctx, &downloader.Request{
+			Method: http.MethodPut,
+			URL:    upload.Href,
+			Header: r.lfsActionHeader(upload),
+			Body:   reader,
+			NoAuth: !r.isHubURL(upload.Href),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if verify := object.Actions.Verify; verify != nil {
+		body, err := json.Marshal(map[string]any{"oid": cf.sha256, "size": cf.size})
+		if err != nil {
+			return errors.Wrap(err, "failed to encode LFS verify request")
+		}
+		header := r.lfsActionHeader(verify)
+		header.Set("Content-Type", "application/json")
+		_, _, err = r.getDownloadManager().Send(ctx, &downloader.Request{
+			Method: http.MethodPost,
+			URL:    verify.Href,
+			Header: header,
+			Body:   bytes.NewReader(body),
+			NoAuth: !r.isHubURL(verify.Href),
+		})
+		if err != nil {
+			return errors.WithMessage(err, "LFS upload verification failed")
+		}
+	}
+	return nil
+}
+
+// uploadLFSMultipart uploads the file in parts to the pre-signed URLs given in the header of the upload action
+// (with the keys "1", "2", ...), and then completes the upload with the ETags of the parts.
+func (r *Repo) uploadLFSMultipart(ctx context.Context, cf *commitFile, upload *lfsAction, reader io.ReaderAt) error {
+	chunkSize, err := strconv.ParseInt(upload.Header["chunk_size"], 10, 64)
+	if err != nil || chunkSize <= 0 {
+		return errors.Errorf("invalid chunk_size %q for multipart LFS upload", upload.Header["chunk_size"])
+	}
+	var partNumbers []int
+	for key := range upload.Header {
+		if partNumber, err := strconv.Atoi(key); err == nil {
+			partNumbers = append(partNumbers, partNumber)
+		}
+	}
+	slices.Sort(partNumbers)
+	if int64(len(partNumbers)) != (cf.size+chunkSize-1)/chunkSize {
+		return errors.Errorf("multipart LFS upload of %d bytes with chunk_size %d given %d parts",
+			cf.size, chunkSize, len(partNumbers))
+	}
+
+	type completedPart struct {
+		PartNumber int    `json:"partNumber"`
+		ETag       string `json:"etag"`
+	}
+	parts := make([]completedPart, len(partNumbers))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for ii, partNumber := range partNumbers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			offset := int64(ii) * chunkSize
+			partURL := upload.Header[strconv.Itoa(partNumber)]
+			_, header, err := r.getDownloadManager().Send(ctx, &downloader.Request{
+				Method: http.MethodPut,
+				URL:    partURL,
+				Body:   io.NewSectionReader(reader, offset, min(chunkSize, cf.size-offset)),
+				NoAuth: !r.isHubURL(partURL),
+			})
+			if err == nil && header.Get("ETag") == "" {
+				err = errors.Errorf("no ETag returned for part %d", partNumber)
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, errors.WithMessagef(err, "while uploading part %d", partNumber))
+				mu.Unlock()
+				return
+			}
+			parts[ii] = completedPart{PartNumber: partNumber, ETag: header.Get("ETag")}
+		}()
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return stderrors.Join(errs...)
+	}
+
+	body, err := json.Marshal(map[string]any{"oid": cf.sha256, "parts": parts})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode multipart LFS completion request")
+	}
+	_, _, err = r.getDownloadManager().Send(ctx, &downloader.Request{
+		Method: http.MethodPost,
+		URL:    upload.Href,
+		Header: lfsHeader,
+		Body:   bytes.NewReader(body),
+		NoAuth: !r.isHubURL(upload.Href),
+	})
+	if err != nil {
+		return errors.WithMessage(err, "failed to complete multipart LFS upload")
+	}
+	return nil
+}
+
+// lfsActionHeader returns the HTTP header to use with the LFS action.
+func (r *Repo) lfsActionHeader(action *lfsAction) http.Header {
+	header := http.Header{}
+	for key, value := range action.Header {
+		header.Set(key, value)
+	}
+	return header
+}
+
+// isHubURL returns whether the URL is in the HuggingFace Hub endpoint, in which case the authentication token is sent.
+// Pre-signed URLs of the LFS storage are usually in a different host, and don't need (or accept) it.
+func (r *Repo) isHubURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	hubURL, err := url.Parse(r.hfEndpoint)
+	if err != nil {
+		return false
+	}
+	return u.Host == hubURL.Host
+}
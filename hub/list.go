@@ -0,0 +1,147 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+)
+
+// ListFilter selects and sorts the repositories listed by ListModels, ListDatasets and ListSpaces.
+// All fields are optional.
+type ListFilter struct {
+	// Search for repositories whose id contains the given string.
+	Search string
+
+	// Author (user or organization) that owns the repositories.
+	Author string
+
+	// Tags that the repositories must have, e.g. "text-classification" or "license:apache-2.0".
+	Tags []string
+
+	// Library used by the models, e.g. "transformers" or "gguf". Only for models.
+	Library string
+
+	// PipelineTag of the models, e.g. "text-generation". Only for models.
+	PipelineTag string
+
+	// Sort by the given property, e.g. "downloads", "likes", "lastModified" or "createdAt".
+	Sort string
+
+	// Direction of the sort: -1 for descending order, 0 (the default) or 1 for ascending order.
+	Direction int
+
+	// Limit the number of repositories listed. If <= 0, all matching repositories are listed.
+	Limit int
+
+	// Full requests the complete RepoInfo of each repository, including the list of files (RepoInfo.Siblings).
+	Full bool
+
+	// Endpoint, AuthToken, HTTPClient and DownloadManager configure the requests to the HuggingFace Hub, as in
+	// Repo.WithEndpoint, Repo.WithAuth, Repo.WithHTTPClient and Repo.WithDownloadManager.
+	// If not set, the same defaults as in New are used. HTTPClient is ignored if DownloadManager is set.
+	Endpoint        string
+	AuthToken       string
+	HTTPClient      *http.Client
+	DownloadManager *downloader.Manager
+}
+
+// ListModels iterates over the models in the HuggingFace Hub that match the filter, which can be nil.
+// The results are fetched one page at a time, as the iteration progresses.
+//
+// Example: list the 10 most downloaded text-generation models in the GGUF format:
+//
+//	for info, err := range hub.ListModels(ctx, &hub.ListFilter{
+//		PipelineTag: "text-generation", Library: "gguf", Sort: "downloads", Direction: -1, Limit: 10}) {
+//		if err != nil { ... }
+//		fmt.Printf("%s: %d downloads\n", info.ID, info.Downloads)
+//	}
+func ListModels(ctx context.Context, filter *ListFilter) iter.Seq2[*RepoInfo, error] {
+	return ListRepos(ctx, RepoTypeModel, filter)
+}
+
+// ListDatasets iterates over the datasets in the HuggingFace Hub that match the filter, which can be nil.
+// See ListModels.
+func ListDatasets(ctx context.Context, filter *ListFilter) iter.Seq2[*RepoInfo, error] {
+	return ListRepos(ctx, RepoTypeDataset, filter)
+}
+
+// ListSpaces iterates over the spaces in the HuggingFace Hub that match the filter, which can be nil.
+// See ListModels.
+func ListSpaces(ctx context.Context, filter *ListFilter) iter.Seq2[*RepoInfo, error] {
+	return ListRepos(ctx, RepoTypeSpace, filter)
+}
+
+// ListRepos iterates over the repositories of the given type in the HuggingFace Hub that match the filter, which
+// can be nil. See ListModels.
+func ListRepos(ctx context.Context, repoType RepoType, filter *ListFilter) iter.Seq2[*RepoInfo, error] {
+	if filter == nil {
+		filter = &ListFilter{}
+	}
+	r := New("").WithType(repoType)
+	if filter.AuthToken != "" {
+		r = r.WithAuth(filter.AuthToken)
+	}
+	if filter.Endpoint != "" {
+		r = r.WithEndpoint(filter.Endpoint)
+	}
+	if filter.DownloadManager != nil {
+		r = r.WithDownloadManager(filter.DownloadManager)
+	}
+	if filter.HTTPClient != nil {
+		r = r.WithHTTPClient(filter.HTTPClient)
+	}
+	listURL := fmt.Sprintf("%s/api/%s", r.hfEndpoint, repoType)
+	if query := filter.query().Encode(); query != "" {
+		listURL += "?" + query
+	}
+	return func(yield func(*RepoInfo, error) bool) {
+		count := 0
+		for info, err := range iterAPIPages[*RepoInfo](ctx, r, listURL) {
+			if !yield(info, err) || err != nil {
+				return
+			}
+			count++
+			if filter.Limit > 0 && count >= filter.Limit {
+				return
+			}
+		}
+	}
+}
+
+// query returns the URL query parameters for the filter, as used by the HuggingFace Hub API.
+func (f *ListFilter) query() url.Values {
+	values := url.Values{}
+	if f.Search != "" {
+		values.Set("search", f.Search)
+	}
+	if f.Author != "" {
+		values.Set("author", f.Author)
+	}
+	for _, tag := range f.Tags {
+		values.Add("filter", tag)
+	}
+	if f.Library != "" {
+		values.Add("filter", f.Library)
+	}
+	if f.PipelineTag != "" {
+		values.Set("pipeline_tag", f.PipelineTag)
+	}
+	if f.Sort != "" {
+		values.Set("sort", f.Sort)
+	}
+	if f.Direction != 0 {
+		values.Set("direction", strconv.Itoa(f.Direction))
+	}
+	if f.Limit > 0 {
+		values.Set("limit", strconv.Itoa(f.Limit))
+	}
+	if f.Full {
+		values.Set("full", "true")
+	}
+	return values
+}
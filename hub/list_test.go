@@ -0,0 +1,73 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListModels(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/models", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		query := r.URL.Query()
+		assert.Equal(t, "gemma", query.Get("search"))
+		assert.Equal(t, "google", query.Get("author"))
+		assert.Equal(t, []string{"license:apache-2.0", "transformers"}, query["filter"])
+		assert.Equal(t, "text-generation", query.Get("pipeline_tag"))
+		assert.Equal(t, "downloads", query.Get("sort"))
+		assert.Equal(t, "-1", query.Get("direction"))
+		assert.Equal(t, "3", query.Get("limit"))
+		if query.Get("cursor") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/models?%s&cursor=page2>; rel="next"`, server.URL, r.URL.RawQuery))
+			_, _ = fmt.Fprint(w, `[{"id": "google/gemma-1", "downloads": 30, "gated": "manual"}, {"id": "google/gemma-2", "downloads": 20}]`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `[{"id": "google/gemma-3", "downloads": 10}, {"id": "google/gemma-4", "downloads": 5}]`)
+	}))
+	defer server.Close()
+
+	filter := &ListFilter{
+		Search:      "gemma",
+		Author:      "google",
+		Tags:        []string{"license:apache-2.0"},
+		Library:     "transformers",
+		PipelineTag: "text-generation",
+		Sort:        "downloads",
+		Direction:   -1,
+		Limit:       3,
+		Endpoint:    server.URL,
+		AuthToken:   "secret",
+	}
+	var ids []string
+	for info, err := range ListModels(context.Background(), filter) {
+		require.NoError(t, err)
+		ids = append(ids, info.ID)
+	}
+	assert.Equal(t, []string{"google/gemma-1", "google/gemma-2", "google/gemma-3"}, ids)
+}
+
+func TestListDatasets(t *testing.T) {
+	// Without a filter AuthToken, the token from the environment is used.
+	t.Setenv("HF_TOKEN", "hf_env")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/datasets", r.URL.Path)
+		assert.Empty(t, r.URL.RawQuery)
+		assert.Equal(t, "Bearer hf_env", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	var numErrors int
+	for _, err := range ListDatasets(context.Background(), &ListFilter{Endpoint: server.URL}) {
+		require.Error(t, err)
+		numErrors++
+	}
+	assert.Equal(t, 1, numErrors)
+}
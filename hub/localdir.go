@@ -0,0 +1,213 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomlx/go-huggingface/internal/files"
+	"github.com/pkg/errors"
+)
+
+// localDirMetadataDir is the subdirectory of a local directory (see Repo.DownloadToDir) where the metadata of
+// the files is kept, the same used by huggingface_hub.
+var localDirMetadataDir = path.Join(".cache", "huggingface", "download")
+
+// DownloadToDir materializes the files of the repository selected by the options (see SnapshotOptions) into dir,
+// as plain files, instead of the symbolic links of the cache structure.
+// It returns the paths to the files in dir. It is the equivalent of huggingface_hub's local_dir mode.
+//
+// The files are first downloaded to the cache (see Repo.DownloadFiles), and then reflinked (a copy-on-write clone)
+// from it when the file system supports it, or copied otherwise. So they can be freely modified.
+// With SnapshotOptions.HardLinks they are hard-linked instead, when possible.
+//
+// For each file, a small metadata file with its commit-hash and etag is kept in "<dir>/.cache/huggingface/download",
+// in the same format used by huggingface_hub, so re-runs skip the files that haven't changed.
+func (r *Repo) DownloadToDir(dir string, opts SnapshotOptions) (localPaths []string, err error) {
+	return r.DownloadToDirContext(context.Background(), dir, opts)
+}
+
+// DownloadToDirContext is like DownloadToDir, but it can be cancelled with ctx.
+func (r *Repo) DownloadToDirContext(ctx context.Context, dir string, opts SnapshotOptions) (localPaths []string, err error) {
+	dir, err = files.ReplaceTildeInDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve directory %q", dir)
+	}
+	fileNames, err := r.filterFileNames(ctx, opts.AllowPatterns, opts.IgnorePatterns)
+	if err != nil {
+		return nil, err
+	}
+	commitHash, err := r.readCommitHashForRevision(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find files that changed since the last run.
+	localPaths = make([]string, len(fileNames))
+	metadata := make([]*localFileMetadata, len(fileNames))
+	var toDownload []string
+	var toDownloadIdx []int
+	for ii, fileName := range fileNames {
+		relativeFilePath := cleanRelativeFilePath(fileName)
+		if relativeFilePath == "." {
+			return nil, errors.Errorf("invalid file name %q", fileName)
+		}
+		localPaths[ii] = path.Join(dir, relativeFilePath)
+		metadata[ii] = readLocalFileMetadata(dir, relativeFilePath)
+		if metadata[ii].isUpToDate(localPaths[ii], commitHash, "") {
+			continue
+		}
+		toDownload = append(toDownload, fileName)
+		toDownloadIdx = append(toDownloadIdx, ii)
+	}
+	if len(toDownload) == 0 {
+		return localPaths, nil
+	}
+
+	cachedPaths, err := r.DownloadFilesContext(ctx, toDownload...)
+	if err != nil {
+		return nil, err
+	}
+	for jj, cachedPath := range cachedPaths {
+		ii := toDownloadIdx[jj]
+		blobPath, err := filepath.EvalSymlinks(cachedPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve cached file %q", cachedPath)
+		}
+		etag := path.Base(blobPath)
+		if !metadata[ii].isUpToDate(localPaths[ii], "", etag) {
+			if err = materializeFile(blobPath, localPaths[ii], opts.HardLinks); err != nil {
+				return nil, errors.WithMessagef(err, "while materializing %q in %q", fileNames[ii], dir)
+			}
+		}
+		// Hard-linked files share the modification time of the blob, which may be in the future (e.g.: clock skew).
+		timestamp := time.Now()
+		if info, err := os.Stat(localPaths[ii]); err == nil {
+			timestamp = latest(timestamp, info.ModTime())
+		}
+		newMetadata := &localFileMetadata{CommitHash: commitHash, ETag: etag, Timestamp: timestamp}
+		if err = newMetadata.write(dir, cleanRelativeFilePath(fileNames[ii])); err != nil {
+			return nil, err
+		}
+	}
+	return localPaths, nil
+}
+
+// localFileMetadata kept for each file in a local directory, see Repo.DownloadToDir.
+type localFileMetadata struct {
+	CommitHash, ETag string
+
+	// Timestamp when the metadata was written: if the file was modified after it, it's no longer up-to-date.
+	Timestamp time.Time
+}
+
+// localFileMetadataPath returns the path of the metadata file for the given file.
+func localFileMetadataPath(dir, relativeFilePath string) string {
+	return path.Join(dir, localDirMetadataDir, relativeFilePath+".metadata")
+}
+
+// readLocalFileMetadata reads the metadata for the given file. It returns nil if it doesn't exist or is invalid.
+//
+// The format is the same used by huggingface_hub: 3 lines with the commit-hash, the etag, and the timestamp
+// (in seconds since the epoch).
+func readLocalFileMetadata(dir, relativeFilePath string) *localFileMetadata {
+	contents, err := os.ReadFile(localFileMetadataPath(dir, relativeFilePath))
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(string(contents), "\n")
+	if len(lines) < 3 {
+		return nil
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(lines[2]), 64)
+	if err != nil {
+		return nil
+	}
+	return &localFileMetadata{
+		CommitHash: strings.TrimSpace(lines[0]),
+		ETag:       strings.TrimSpace(lines[1]),
+		Timestamp:  time.UnixMicro(int64(seconds * 1e6)),
+	}
+}
+
+// write the metadata for the given file.
+func (m *localFileMetadata) write(dir, relativeFilePath string) error {
+	metadataPath := localFileMetadataPath(dir, relativeFilePath)
+	if err := os.MkdirAll(path.Dir(metadataPath), DefaultDirCreationPerm); err != nil {
+		return errors.Wrapf(err, "while creating metadata directory %q", path.Dir(metadataPath))
+	}
+	contents := fmt.Sprintf("%s\n%s\n%f\n", m.CommitHash, m.ETag, float64(m.Timestamp.UnixMicro())/1e6)
+	if err := os.WriteFile(metadataPath, []byte(contents), DefaultFileCreationPerm); err != nil {
+		return errors.Wrapf(err, "while writing metadata file %q", metadataPath)
+	}
+	return nil
+}
+
+// isUpToDate returns whether the local file exists, hasn't been modified since the metadata was written, and the
+// metadata matches the commitHash or the etag (whichever is not empty).
+func (m *localFileMetadata) isUpToDate(localPath, commitHash, etag string) bool {
+	if m == nil {
+		return false
+	}
+	if (commitHash != "" && m.CommitHash != commitHash) || (etag != "" && m.ETag != etag) {
+		return false
+	}
+	info, err := os.Stat(localPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	// Timestamp is stored with microsecond precision.
+	return !info.ModTime().Truncate(time.Microsecond).After(m.Timestamp)
+}
+
+// materializeFile creates dst with the contents of the blob, using (in order of preference) a hard link, if
+// hardLink is true, a reflink, or a copy of the file.
+//
+// The file is first created in a temporary file, and then atomically moved to dst.
+func materializeFile(blobPath, dst string, hardLink bool) error {
+	if err := os.MkdirAll(path.Dir(dst), DefaultDirCreationPerm); err != nil {
+		return errors.Wrapf(err, "while creating directory for %q", dst)
+	}
+	tmpPath := fmt.Sprintf("%s.%s.tmp", dst, SessionId)
+	_ = os.Remove(tmpPath)
+	if !hardLink || os.Link(blobPath, tmpPath) != nil {
+		if err := reflink(blobPath, tmpPath); err != nil {
+			if err = copyFile(blobPath, tmpPath); err != nil {
+				_ = os.Remove(tmpPath)
+				return err
+			}
+		}
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "failed to move %q to %q", tmpPath, dst)
+	}
+	return nil
+}
+
+// copyFile copies the contents of src to a new file dst.
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %q", src)
+	}
+	defer func() { _ = srcFile.Close() }()
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, DefaultFileCreationPerm)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %q", dst)
+	}
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		_ = dstFile.Close()
+		return errors.Wrapf(err, "failed to copy %q to %q", src, dst)
+	}
+	if err = dstFile.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close %q", dst)
+	}
+	return nil
+}
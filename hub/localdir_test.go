@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadToDir(t *testing.T) {
+	repo := New("owner/model").WithCacheDir(t.TempDir()).WithOffline(true)
+	repoCacheDir := repo.RepoCacheDir()
+	const commitHash = "0123456789abcdef0123456789abcdef01234567"
+	writeTestBlob(t, repoCacheDir, commitHash, "config.json", "aaaa", []byte("{}"))
+	writeTestBlob(t, repoCacheDir, commitHash, "onnx/model.onnx", "bbbb", []byte("onnx"))
+	writeTestBlob(t, repoCacheDir, commitHash, "model.safetensors", "cccc", []byte("safetensors"))
+	require.NoError(t, os.MkdirAll(path.Join(repoCacheDir, "refs"), DefaultDirCreationPerm))
+	require.NoError(t, os.WriteFile(path.Join(repoCacheDir, "refs", "main"), []byte(commitHash), DefaultFileCreationPerm))
+
+	dir := t.TempDir()
+	opts := SnapshotOptions{IgnorePatterns: []string{"onnx/"}}
+	localPaths, err := repo.DownloadToDir(dir, opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{path.Join(dir, "config.json"), path.Join(dir, "model.safetensors")}, localPaths)
+	for _, localPath := range localPaths {
+		info, err := os.Lstat(localPath)
+		require.NoError(t, err)
+		assert.True(t, info.Mode().IsRegular(), "%q should be a regular file", localPath)
+	}
+	contents, err := os.ReadFile(localPaths[1])
+	require.NoError(t, err)
+	assert.Equal(t, "safetensors", string(contents))
+	assert.NoFileExists(t, path.Join(dir, "onnx", "model.onnx"))
+
+	metadata := readLocalFileMetadata(dir, "model.safetensors")
+	require.NotNil(t, metadata)
+	assert.Equal(t, commitHash, metadata.CommitHash)
+	assert.Equal(t, "cccc", metadata.ETag)
+	assert.True(t, metadata.isUpToDate(localPaths[1], commitHash, ""))
+
+	// Locally modified file is materialized again.
+	require.NoError(t, os.Remove(localPaths[0]))
+	require.NoError(t, os.WriteFile(localPaths[0], []byte("modified"), DefaultFileCreationPerm))
+	modified := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(localPaths[0], modified, modified))
+	assert.False(t, readLocalFileMetadata(dir, "config.json").isUpToDate(localPaths[0], commitHash, ""))
+	_, err = repo.DownloadToDir(dir, opts)
+	require.NoError(t, err)
+	assert.True(t, readLocalFileMetadata(dir, "config.json").isUpToDate(localPaths[0], commitHash, ""))
+	contents, err = os.ReadFile(localPaths[0])
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(contents))
+
+	// By default, files don't share their contents with the cache: modifying them in place doesn't change it.
+	blobPath := path.Join(repoCacheDir, "blobs", "cccc")
+	sameFile := func(localPath string) bool {
+		localInfo, err := os.Stat(localPath)
+		require.NoError(t, err)
+		blobInfo, err := os.Stat(blobPath)
+		require.NoError(t, err)
+		return os.SameFile(localInfo, blobInfo)
+	}
+	assert.False(t, sameFile(localPaths[1]))
+	f, err := os.OpenFile(localPaths[1], os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("SAFE"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	contents, err = os.ReadFile(blobPath)
+	require.NoError(t, err)
+	assert.Equal(t, "safetensors", string(contents))
+
+	// Hard links, if requested.
+	dir = t.TempDir()
+	opts.HardLinks = true
+	localPaths, err = repo.DownloadToDir(dir, opts)
+	require.NoError(t, err)
+	assert.True(t, sameFile(localPaths[1]))
+}
@@ -0,0 +1,73 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithLogger sets the logger used to report problems (e.g. failure to remove temporary files) and, depending on
+// Verbosity, downloads and their progress. Log records have structured attributes, like "repo", "revision", "file",
+// "url", "bytes" and "duration". It is also used by the download manager, if it's created by the Repo.
+//
+// Verbosity is mapped onto the minimum level logged: 0 logs only warnings and errors, 1 adds slog.LevelInfo
+// (downloads and their progress, if progress bars are not used, see Repo.WithProgressBar), and 2 or higher
+// adds slog.LevelDebug.
+//
+// If not set (or set to nil), slog.Default() is used.
+func (r *Repo) WithLogger(logger *slog.Logger) *Repo {
+	r.logger = logger
+	return r
+}
+
+// getLogger returns the logger of the Repo (see Repo.WithLogger), filtered by the level given by Verbosity, and with
+// the repository and revision attributes.
+func (r *Repo) getLogger() *slog.Logger {
+	return r.levelLogger().With("repo", r.ID, "revision", r.revision)
+}
+
+// levelLogger returns the logger of the Repo (see Repo.WithLogger), filtered by the level given by Verbosity.
+func (r *Repo) levelLogger() *slog.Logger {
+	logger := r.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return slog.New(&levelHandler{level: verbosityLevel(r.Verbosity), handler: logger.Handler()})
+}
+
+// verbosityLevel returns the minimum slog.Level logged for the given Verbosity.
+func verbosityLevel(verbosity int) slog.Level {
+	switch {
+	case verbosity <= 0:
+		return slog.LevelWarn
+	case verbosity == 1:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// levelHandler is a slog.Handler that drops the records below a minimum level, and passes on the others.
+type levelHandler struct {
+	level   slog.Level
+	handler slog.Handler
+}
+
+// Enabled implements slog.Handler.
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.handler.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler.
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, handler: h.handler.WithGroup(name)}
+}
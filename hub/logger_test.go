@@ -0,0 +1,47 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithLogger(t *testing.T) {
+	const commitHash = "0123456789abcdef0123456789abcdef01234567"
+	server := newTestFileServer(t, commitHash, map[string][]byte{"config.json": []byte("{}")})
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	// Verbosity 0: only warnings and errors.
+	repo := New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint(server.URL).WithRevision(commitHash).
+		WithProgressBar(false).WithLogger(logger)
+	repo.Verbosity = 0
+	_, err := repo.DownloadFile("config.json")
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+
+	// Verbosity 2: download progress and debug records.
+	repo = New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint(server.URL).WithRevision(commitHash).
+		WithProgressBar(false).WithLogger(logger)
+	repo.Verbosity = 2
+	_, err = repo.DownloadFile("config.json")
+	require.NoError(t, err)
+	var messages []string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(line, &record))
+		assert.Equal(t, "owner/model", record["repo"])
+		messages = append(messages, record["msg"].(string))
+		if record["msg"] == "downloaded file" && record["level"] == "INFO" {
+			assert.Equal(t, "config.json", record["file"])
+			assert.Equal(t, 2.0, record["bytes"])
+		}
+	}
+	assert.Contains(t, messages, "downloading file")
+	assert.Contains(t, messages, "downloaded file")
+	assert.Contains(t, messages, "downloaded files")
+}
@@ -0,0 +1,234 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gomlx/go-huggingface/internal/downloader"
+	"github.com/pkg/errors"
+)
+
+// Repository management: creation, deletion, settings, branches and tags.
+//
+// They all require an authentication token with write access: set in the Repo (see Repo.WithAuth), or given by the
+// environment (see SettingsFromEnv) for the package-level functions.
+
+// defaultSpaceSDK is used to create spaces, see Repo.CreateRepo.
+const defaultSpaceSDK = "static"
+
+// repoRequest returns the fields that identify the repository in the requests to the "/api/repos/*" endpoints.
+func (r *Repo) repoRequest() map[string]any {
+	request := map[string]any{}
+	if organization, name, found := strings.Cut(r.ID, "/"); found {
+		request["organization"] = organization
+		request["name"] = name
+	} else {
+		request["name"] = r.ID
+	}
+	if r.repoType != RepoTypeModel {
+		request["type"] = r.repoType.singular()
+	}
+	return request
+}
+
+// singular returns the repository type as used in the "/api/repos/*" endpoints: "model", "dataset" or "space".
+func (t RepoType) singular() string {
+	return strings.TrimSuffix(string(t), "s")
+}
+
+// hasStatusCode returns whether err was caused by a response from the server with the given HTTP status code.
+func hasStatusCode(err error, statusCode int) bool {
+	var statusErr *downloader.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == statusCode
+}
+
+// CreateRepo creates the repository in the HuggingFace Hub, with the ID and type of the Repo, and returns its URL.
+// Spaces are created with the "static" SDK.
+//
+// If existOK is true, it's not an error if the repository already exists.
+//
+// The request is not retried on failures, since a retry after the repository was created would fail with a conflict.
+func (r *Repo) CreateRepo(ctx context.Context, private, existOK bool) (repoURL string, err error) {
+	request := r.repoRequest()
+	request["private"] = private
+	if r.repoType == RepoTypeSpace {
+		request["sdk"] = defaultSpaceSDK
+	}
+	var response struct {
+		URL string `json:"url"`
+	}
+	err = sendJSON(ctx, r, http.MethodPost, r.hfEndpoint+"/api/repos/create", request, &response)
+	if err != nil {
+		if existOK && hasStatusCode(err, http.StatusConflict) {
+			return r.repoURL(), nil
+		}
+		return "", errors.WithMessagef(err, "failed to create repository %q", r.ID)
+	}
+	return response.URL, nil
+}
+
+// CreateRepo creates the repository with the given id and type in the HuggingFace Hub, and returns its URL.
+//
+// It uses the endpoint and the authentication token given by the environment (see SettingsFromEnv). To configure
+// them, use Repo.CreateRepo instead, e.g.:
+//
+//	repoURL, err := hub.New(id).WithType(repoType).WithAuth(token).CreateRepo(ctx, private, existOK)
+//
+// If existOK is true, it's not an error if the repository already exists.
+func CreateRepo(ctx context.Context, id string, repoType RepoType, private, existOK bool) (repoURL string, err error) {
+	return New(id).WithType(repoType).CreateRepo(ctx, private, existOK)
+}
+
+// DeleteRepo deletes the repository from the HuggingFace Hub. It can't be undone.
+//
+// If missingOK is true, it's not an error if the repository doesn't exist.
+//
+// Like Repo.CreateRepo, the request is not retried on failures.
+func (r *Repo) DeleteRepo(ctx context.Context, missingOK bool) error {
+	err := sendJSON(ctx, r, http.MethodDelete, r.hfEndpoint+"/api/repos/delete", r.repoRequest(), nil)
+	if err != nil {
+		if missingOK && hasStatusCode(err, http.StatusNotFound) {
+			return nil
+		}
+		return errors.WithMessagef(err, "failed to delete repository %q", r.ID)
+	}
+	return nil
+}
+
+// DeleteRepo deletes the repository with the given id and type from the HuggingFace Hub. It can't be undone.
+// Like CreateRepo, it uses the endpoint and the authentication token given by the environment: see Repo.DeleteRepo.
+func DeleteRepo(ctx context.Context, id string, repoType RepoType, missingOK bool) error {
+	return New(id).WithType(repoType).DeleteRepo(ctx, missingOK)
+}
+
+// MoveRepo moves (renames) the repository to newID, possibly to a different owner. On success, the Repo ID is
+// updated to newID.
+func (r *Repo) MoveRepo(ctx context.Context, newID string) error {
+	request := map[string]any{"fromRepo": r.ID, "toRepo": newID, "type": r.repoType.singular()}
+	if err := sendJSON(ctx, r, http.MethodPost, r.hfEndpoint+"/api/repos/move", request, nil); err != nil {
+		return errors.WithMessagef(err, "failed to move repository %q to %q", r.ID, newID)
+	}
+	r.ID = newID
+	r.info = nil
+	return nil
+}
+
+// MoveRepo moves (renames) the repository with the given id and type to newID, possibly to a different owner.
+// Like CreateRepo, it uses the endpoint and the authentication token given by the environment: see Repo.MoveRepo.
+func MoveRepo(ctx context.Context, id string, repoType RepoType, newID string) error {
+	return New(id).WithType(repoType).MoveRepo(ctx, newID)
+}
+
+// RepoSettings to change with Repo.UpdateRepoSettings. Only the fields not nil are changed.
+type RepoSettings struct {
+	Private *bool
+
+	// Gated access mode: "auto", "manual" or "" to disable it.
+	Gated *GatedMode
+}
+
+// UpdateRepoSettings changes the visibility (private or public) and the gated access mode of the repository.
+func (r *Repo) UpdateRepoSettings(ctx context.Context, settings RepoSettings) error {
+	request := map[string]any{}
+	if settings.Private != nil {
+		request["private"] = *settings.Private
+	}
+	if settings.Gated != nil {
+		if *settings.Gated == "" {
+			request["gated"] = false
+		} else {
+			request["gated"] = *settings.Gated
+		}
+	}
+	if len(request) == 0 {
+		return nil
+	}
+	if err := sendJSON(ctx, r, http.MethodPut, r.apiURL()+"/settings", request, nil); err != nil {
+		return errors.WithMessagef(err, "failed to update settings of repository %q", r.ID)
+	}
+	return nil
+}
+
+// UpdateRepoSettings changes the settings of the repository with the given id and type.
+// Like CreateRepo, it uses the endpoint and the authentication token given by the environment: see
+// Repo.UpdateRepoSettings.
+func UpdateRepoSettings(ctx context.Context, id string, repoType RepoType, settings RepoSettings) error {
+	return New(id).WithType(repoType).UpdateRepoSettings(ctx, settings)
+}
+
+// CreateBranch creates the branch in the repository, starting from the given revision (a branch, tag or commit-hash).
+// If startingPoint is empty, the branch starts from the head of the "main" branch.
+func (r *Repo) CreateBranch(ctx context.Context, branch, startingPoint string) error {
+	request := map[string]any{}
+	if startingPoint != "" {
+		request["startingPoint"] = startingPoint
+	}
+	branchURL := fmt.Sprintf("%s/branch/%s", r.apiURL(), url.PathEscape(branch))
+	if err := sendJSON(ctx, r, http.MethodPost, branchURL, request, nil); err != nil {
+		return errors.WithMessagef(err, "failed to create branch %q in repository %q", branch, r.ID)
+	}
+	return nil
+}
+
+// CreateBranch creates the branch in the repository with the given id and type.
+// Like CreateRepo, it uses the endpoint and the authentication token given by the environment: see Repo.CreateBranch.
+func CreateBranch(ctx context.Context, id string, repoType RepoType, branch, startingPoint string) error {
+	return New(id).WithType(repoType).CreateBranch(ctx, branch, startingPoint)
+}
+
+// DeleteBranch deletes the branch from the repository.
+func (r *Repo) DeleteBranch(ctx context.Context, branch string) error {
+	branchURL := fmt.Sprintf("%s/branch/%s", r.apiURL(), url.PathEscape(branch))
+	if err := sendAPI(ctx, r, &downloader.Request{Method: http.MethodDelete, URL: branchURL}, nil); err != nil {
+		return errors.WithMessagef(err, "failed to delete branch %q from repository %q", branch, r.ID)
+	}
+	return nil
+}
+
+// DeleteBranch deletes the branch from the repository with the given id and type.
+// Like CreateRepo, it uses the endpoint and the authentication token given by the environment: see Repo.DeleteBranch.
+func DeleteBranch(ctx context.Context, id string, repoType RepoType, branch string) error {
+	return New(id).WithType(repoType).DeleteBranch(ctx, branch)
+}
+
+// CreateTag creates the tag pointing to the revision of the Repo (see Repo.WithRevision), with an optional message.
+func (r *Repo) CreateTag(ctx context.Context, tag, message string) error {
+	request := map[string]any{"tag": tag}
+	if message != "" {
+		request["message"] = message
+	}
+	tagURL := fmt.Sprintf("%s/tag/%s", r.apiURL(), url.PathEscape(r.revision))
+	if err := sendJSON(ctx, r, http.MethodPost, tagURL, request, nil); err != nil {
+		return errors.WithMessagef(err, "failed to create tag %q in repository %q", tag, r.ID)
+	}
+	return nil
+}
+
+// CreateTag creates the tag pointing to the revision (a branch, tag or commit-hash, "main" if empty) of the repository
+// with the given id and type, with an optional message.
+// Like CreateRepo, it uses the endpoint and the authentication token given by the environment: see Repo.CreateTag.
+func CreateTag(ctx context.Context, id string, repoType RepoType, tag, revision, message string) error {
+	r := New(id).WithType(repoType)
+	if revision != "" {
+		r = r.WithRevision(revision)
+	}
+	return r.CreateTag(ctx, tag, message)
+}
+
+// DeleteTag deletes the tag from the repository.
+func (r *Repo) DeleteTag(ctx context.Context, tag string) error {
+	tagURL := fmt.Sprintf("%s/tag/%s", r.apiURL(), url.PathEscape(tag))
+	if err := sendAPI(ctx, r, &downloader.Request{Method: http.MethodDelete, URL: tagURL}, nil); err != nil {
+		return errors.WithMessagef(err, "failed to delete tag %q from repository %q", tag, r.ID)
+	}
+	return nil
+}
+
+// DeleteTag deletes the tag from the repository with the given id and type.
+// Like CreateRepo, it uses the endpoint and the authentication token given by the environment: see Repo.DeleteTag.
+func DeleteTag(ctx context.Context, id string, repoType RepoType, tag string) error {
+	return New(id).WithType(repoType).DeleteTag(ctx, tag)
+}
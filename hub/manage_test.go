@@ -0,0 +1,135 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoManagement(t *testing.T) {
+	type request struct {
+		Method, Path string
+		Body         map[string]any
+	}
+	var requests []request
+	repos := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		req := request{Method: r.Method, Path: r.URL.Path}
+		if content, _ := io.ReadAll(r.Body); len(content) > 0 {
+			assert.NoError(t, json.Unmarshal(content, &req.Body))
+		}
+		requests = append(requests, req)
+		switch r.URL.Path {
+		case "/api/repos/create":
+			if repos[req.Body["name"].(string)] {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			repos[req.Body["name"].(string)] = true
+			_, _ = w.Write([]byte(`{"url": "https://hf.co/datasets/org/data"}`))
+		case "/api/repos/delete":
+			if !repos[req.Body["name"].(string)] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(repos, req.Body["name"].(string))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	repo := New("org/data").WithType(RepoTypeDataset).WithCacheDir(t.TempDir()).WithEndpoint(server.URL).WithAuth("secret")
+	repoURL, err := repo.CreateRepo(ctx, true, false)
+	require.NoError(t, err)
+	assert.Equal(t, "https://hf.co/datasets/org/data", repoURL)
+	_, err = repo.CreateRepo(ctx, true, false)
+	require.Error(t, err)
+	_, err = repo.CreateRepo(ctx, true, true)
+	require.NoError(t, err)
+
+	private, gated := false, GatedMode("manual")
+	require.NoError(t, repo.UpdateRepoSettings(ctx, RepoSettings{Private: &private, Gated: &gated}))
+	require.NoError(t, repo.CreateBranch(ctx, "dev", "v1.0"))
+	require.NoError(t, repo.DeleteBranch(ctx, "dev"))
+	require.NoError(t, repo.WithRevision("dev").CreateTag(ctx, "v2.0", "Second version"))
+	require.NoError(t, repo.DeleteTag(ctx, "v2.0"))
+	require.NoError(t, repo.MoveRepo(ctx, "org/data2"))
+	assert.Equal(t, "org/data2", repo.ID)
+	require.NoError(t, New("org/data").WithType(RepoTypeDataset).WithEndpoint(server.URL).WithAuth("secret").DeleteRepo(ctx, false))
+	require.Error(t, repo.DeleteRepo(ctx, false))
+	require.NoError(t, repo.DeleteRepo(ctx, true))
+
+	createBody := map[string]any{"organization": "org", "name": "data", "type": "dataset", "private": true}
+	deleteBody := map[string]any{"organization": "org", "name": "data2", "type": "dataset"}
+	want := []request{
+		{"POST", "/api/repos/create", createBody},
+		{"POST", "/api/repos/create", createBody},
+		{"POST", "/api/repos/create", createBody},
+		{"PUT", "/api/datasets/org/data/settings", map[string]any{"private": false, "gated": "manual"}},
+		{"POST", "/api/datasets/org/data/branch/dev", map[string]any{"startingPoint": "v1.0"}},
+		{"DELETE", "/api/datasets/org/data/branch/dev", nil},
+		{"POST", "/api/datasets/org/data/tag/dev", map[string]any{"tag": "v2.0", "message": "Second version"}},
+		{"DELETE", "/api/datasets/org/data/tag/v2.0", nil},
+		{"POST", "/api/repos/move", map[string]any{"fromRepo": "org/data", "toRepo": "org/data2", "type": "dataset"}},
+		{"DELETE", "/api/repos/delete", map[string]any{"organization": "org", "name": "data", "type": "dataset"}},
+		{"DELETE", "/api/repos/delete", deleteBody},
+		{"DELETE", "/api/repos/delete", deleteBody},
+	}
+	assert.Equal(t, want, requests)
+}
+
+func TestCreateRepo(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		// The repository may have been created, even if the server fails to respond.
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	t.Setenv("HF_ENDPOINT", server.URL)
+	t.Setenv("HF_TOKEN", "secret")
+
+	_, err := CreateRepo(context.Background(), "org/model", RepoTypeModel, true, false)
+	require.Error(t, err)
+	assert.True(t, hasStatusCode(err, http.StatusBadGateway))
+	assert.Equal(t, []string{"/api/repos/create"}, paths, "creation must not be retried")
+}
+
+func TestManagementFunctions(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		requests = append(requests, r.Method+" "+r.URL.Path)
+	}))
+	defer server.Close()
+	t.Setenv("HF_ENDPOINT", server.URL)
+	t.Setenv("HF_TOKEN", "secret")
+
+	ctx := context.Background()
+	private := true
+	require.NoError(t, UpdateRepoSettings(ctx, "org/model", RepoTypeModel, RepoSettings{Private: &private}))
+	require.NoError(t, CreateBranch(ctx, "org/model", RepoTypeModel, "dev", ""))
+	require.NoError(t, DeleteBranch(ctx, "org/model", RepoTypeModel, "dev"))
+	require.NoError(t, CreateTag(ctx, "org/model", RepoTypeModel, "v1.0", "", ""))
+	require.NoError(t, CreateTag(ctx, "org/model", RepoTypeModel, "v2.0", "dev", "Second version"))
+	require.NoError(t, DeleteTag(ctx, "org/model", RepoTypeModel, "v1.0"))
+	require.NoError(t, MoveRepo(ctx, "org/model", RepoTypeModel, "org/model2"))
+	require.NoError(t, DeleteRepo(ctx, "org/model2", RepoTypeModel, false))
+	assert.Equal(t, []string{
+		"PUT /api/models/org/model/settings",
+		"POST /api/models/org/model/branch/dev",
+		"DELETE /api/models/org/model/branch/dev",
+		"POST /api/models/org/model/tag/main",
+		"POST /api/models/org/model/tag/dev",
+		"DELETE /api/models/org/model/tag/v1.0",
+		"POST /api/repos/move",
+		"DELETE /api/repos/delete",
+	}, requests)
+}
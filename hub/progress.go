@@ -0,0 +1,363 @@
+package hub
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// ProgressEventKind is the kind of a ProgressEvent.
+type ProgressEventKind int
+
+const (
+	// ProgressDownloading reports the progress of the download of a file. The first event of a file is sent when its
+	// download starts, and then periodically.
+	ProgressDownloading ProgressEventKind = iota
+
+	// ProgressCacheHit reports a file that didn't need to be downloaded, because it was already in the cache.
+	ProgressCacheHit
+
+	// ProgressFileDone reports that the download of a file finished successfully.
+	ProgressFileDone
+
+	// ProgressError reports the error that interrupted the download of the files. Only the first error is reported.
+	ProgressError
+
+	// ProgressDone reports the end of the call to Repo.DownloadFiles (or a similar method), with the total bytes
+	// downloaded and the error, if any. It is always the last event.
+	ProgressDone
+)
+
+// String implements fmt.Stringer.
+func (k ProgressEventKind) String() string {
+	switch k {
+	case ProgressDownloading:
+		return "Downloading"
+	case ProgressCacheHit:
+		return "CacheHit"
+	case ProgressFileDone:
+		return "FileDone"
+	case ProgressError:
+		return "Error"
+	case ProgressDone:
+		return "Done"
+	default:
+		return fmt.Sprintf("ProgressEventKind(%d)", int(k))
+	}
+}
+
+// ProgressEvent is sent to a ProgressReporter during the download of files.
+type ProgressEvent struct {
+	Kind ProgressEventKind
+
+	// Repo is the ID of the repository.
+	Repo string
+
+	// File is the name of the file in the repository. It is empty for ProgressDone, and it may be empty for
+	// ProgressError if the error is not specific to a file.
+	File string
+
+	// TotalBytes is the size of the file, or 0 if not known.
+	// For ProgressDone, it is the total number of bytes downloaded.
+	TotalBytes int64
+
+	// DoneBytes downloaded so far, including the ones of a previously interrupted download being resumed.
+	DoneBytes int64
+
+	// Rate of the download of the file in bytes per second, and the ETA (estimated time to finish it).
+	// They are 0 if not known.
+	Rate float64
+	ETA  time.Duration
+
+	// Err is set for ProgressError, and for ProgressDone if the download failed.
+	Err error
+}
+
+// ProgressReporter receives the progress of the download of files. See Repo.WithProgressReporter.
+//
+// Report may be called concurrently, if the reporter is shared by Repos downloading at the same time, and it
+// should return quickly, since downloads wait for it.
+//
+// Built-in implementations: NewTerminalProgress, NewLogProgress, NoProgress and NewChannelProgress.
+type ProgressReporter interface {
+	Report(event ProgressEvent)
+}
+
+// progressReportInterval is the minimum interval between ProgressDownloading events of the same file.
+const progressReportInterval = 200 * time.Millisecond
+
+// NoProgress is a ProgressReporter that ignores all events.
+type NoProgress struct{}
+
+// Report implements ProgressReporter.
+func (NoProgress) Report(ProgressEvent) {}
+
+// channelProgress implements NewChannelProgress.
+type channelProgress chan<- ProgressEvent
+
+// NewChannelProgress returns a ProgressReporter that sends the events to the channel, e.g. to update a GUI.
+//
+// ProgressDownloading events are dropped if the channel is not ready to receive them, so a slow receiver doesn't
+// slow down the downloads. All other events are always sent, blocking if needed.
+//
+// The channel is never closed, the ProgressDone event signals the end of each download.
+func NewChannelProgress(ch chan<- ProgressEvent) ProgressReporter {
+	return channelProgress(ch)
+}
+
+// Report implements ProgressReporter.
+func (ch channelProgress) Report(event ProgressEvent) {
+	if event.Kind == ProgressDownloading {
+		select {
+		case ch <- event:
+		default:
+		}
+		return
+	}
+	ch <- event
+}
+
+// progressCounts of the files downloaded from a repository, used to report a summary on ProgressDone.
+type progressCounts struct {
+	files int
+	bytes int64
+}
+
+// countDone updates the counts with the event, and returns the counts of the repository on ProgressDone.
+func countDone(counts map[string]*progressCounts, event ProgressEvent) (done progressCounts) {
+	switch event.Kind {
+	case ProgressFileDone:
+		c := counts[event.Repo]
+		if c == nil {
+			c = &progressCounts{}
+			counts[event.Repo] = c
+		}
+		c.files++
+	case ProgressDone:
+		if c := counts[event.Repo]; c != nil {
+			done = *c
+			delete(counts, event.Repo)
+		}
+		done.bytes = event.TotalBytes
+	}
+	return
+}
+
+// formatProgress returns the progress of a file as a string, e.g.: "45% of 2.7 GB, 35 MB/s, ETA 40s".
+func formatProgress(event ProgressEvent) string {
+	var parts []string
+	if event.TotalBytes > 0 {
+		parts = append(parts, fmt.Sprintf("%d%% of %s", 100*event.DoneBytes/event.TotalBytes,
+			humanize.Bytes(uint64(event.TotalBytes))))
+	} else {
+		parts = append(parts, humanize.Bytes(uint64(event.DoneBytes)))
+	}
+	if event.Rate > 0 {
+		parts = append(parts, humanize.Bytes(uint64(event.Rate))+"/s")
+	}
+	if event.ETA > 0 {
+		parts = append(parts, "ETA "+event.ETA.Round(time.Second).String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// terminalProgress implements NewTerminalProgress.
+type terminalProgress struct {
+	mu     sync.Mutex
+	w      io.Writer
+	active []*ProgressEvent // Last event of the files being downloaded, in the order they started.
+	drawn  int              // Number of lines drawn with the active files.
+	counts map[string]*progressCounts
+}
+
+// terminalBarWidth is the width of the progress bars, in characters.
+const terminalBarWidth = 30
+
+// NewTerminalProgress returns a ProgressReporter that draws a progress bar per file being downloaded, updated in
+// place using ANSI escape codes. Finished files and errors are printed as permanent lines above the progress bars.
+//
+// The writer w should be a terminal, typically os.Stdout or os.Stderr.
+func NewTerminalProgress(w io.Writer) ProgressReporter {
+	return &terminalProgress{w: w, counts: make(map[string]*progressCounts)}
+}
+
+// Report implements ProgressReporter.
+func (p *terminalProgress) Report(event ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var permanent []string
+	done := countDone(p.counts, event)
+	switch event.Kind {
+	case ProgressDownloading:
+		if idx := p.activeIndex(event); idx >= 0 {
+			*p.active[idx] = event
+		} else {
+			p.active = append(p.active, &event)
+		}
+	case ProgressCacheHit:
+		return
+	case ProgressFileDone:
+		p.removeActive(event)
+		permanent = append(permanent, fmt.Sprintf("%s: downloaded %s", event.File, humanize.Bytes(uint64(event.TotalBytes))))
+	case ProgressError:
+		p.removeActive(event)
+		if event.File != "" {
+			permanent = append(permanent, fmt.Sprintf("%s: error - %v", event.File, event.Err))
+		} else {
+			permanent = append(permanent, fmt.Sprintf("%s: error - %v", event.Repo, event.Err))
+		}
+	case ProgressDone:
+		// Interrupted downloads of the repository are no longer active.
+		numActive := len(p.active)
+		p.active = slices.DeleteFunc(p.active, func(active *ProgressEvent) bool { return active.Repo == event.Repo })
+		if done.files == 0 && len(p.active) == numActive {
+			return
+		}
+		if done.files > 0 {
+			permanent = append(permanent, fmt.Sprintf("Downloaded %d files (%s) from %s", done.files,
+				humanize.Bytes(uint64(done.bytes)), event.Repo))
+		}
+	}
+	p.redraw(permanent)
+}
+
+// activeIndex returns the index of the file of the event in the active files, or -1 if not there.
+func (p *terminalProgress) activeIndex(event ProgressEvent) int {
+	for ii, active := range p.active {
+		if active.Repo == event.Repo && active.File == event.File {
+			return ii
+		}
+	}
+	return -1
+}
+
+// removeActive removes the file of the event from the active files.
+func (p *terminalProgress) removeActive(event ProgressEvent) {
+	if idx := p.activeIndex(event); idx >= 0 {
+		p.active = append(p.active[:idx], p.active[idx+1:]...)
+	}
+}
+
+// redraw the active files progress bars, after printing the permanent lines.
+func (p *terminalProgress) redraw(permanent []string) {
+	var sb strings.Builder
+	if p.drawn > 0 {
+		// Move to the start of the first line drawn, and clear everything after it.
+		_, _ = fmt.Fprintf(&sb, "\x1b[%dA\r\x1b[J", p.drawn)
+	}
+	for _, line := range permanent {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	for _, event := range p.active {
+		bar := strings.Repeat(" ", terminalBarWidth)
+		if event.TotalBytes > 0 {
+			filled := int(int64(terminalBarWidth) * min(event.DoneBytes, event.TotalBytes) / event.TotalBytes)
+			bar = strings.Repeat("=", filled) + strings.Repeat(" ", terminalBarWidth-filled)
+		}
+		_, _ = fmt.Fprintf(&sb, "%s [%s] %s\n", event.File, bar, formatProgress(*event))
+	}
+	p.drawn = len(p.active)
+	_, _ = io.WriteString(p.w, sb.String())
+}
+
+// logProgress implements NewLogProgress.
+type logProgress struct {
+	mu       sync.Mutex
+	logger   *slog.Logger
+	interval time.Duration
+	files    map[string]*logProgressFile // Per "<repo>/<file>" being downloaded.
+	counts   map[string]*progressCounts
+}
+
+// logProgressFile holds when the download of a file started and was last logged.
+type logProgressFile struct {
+	start, lastLogged time.Time
+}
+
+// NewLogProgress returns a ProgressReporter that logs (at slog.LevelInfo) when the download of a file starts, its
+// progress at most once every interval, when it finishes, and a summary at the end. Errors are logged at
+// slog.LevelError. It is suitable for CI and structured service logs, and the records have the attributes "repo",
+// "file", "bytes", "done_bytes", "rate" (in bytes per second), "eta" and "duration".
+//
+// If logger is nil, slog.Default() is used. If interval is 0, it defaults to 30 seconds.
+func NewLogProgress(logger *slog.Logger, interval time.Duration) ProgressReporter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &logProgress{logger: logger, interval: interval, files: make(map[string]*logProgressFile),
+		counts: make(map[string]*progressCounts)}
+}
+
+// Report implements ProgressReporter.
+func (p *logProgress) Report(event ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	done := countDone(p.counts, event)
+	key := event.Repo + "/" + event.File
+	now := time.Now()
+	switch event.Kind {
+	case ProgressDownloading:
+		file, found := p.files[key]
+		if !found {
+			p.files[key] = &logProgressFile{start: now, lastLogged: now}
+			p.logger.Info("downloading file", "repo", event.Repo, "file", event.File, "bytes", event.TotalBytes)
+			return
+		}
+		if now.Sub(file.lastLogged) >= p.interval {
+			file.lastLogged = now
+			p.logger.Info("download progress", "repo", event.Repo, "file", event.File, "bytes", event.TotalBytes,
+				"done_bytes", event.DoneBytes, "rate", int64(event.Rate), "eta", event.ETA.Round(time.Second))
+		}
+	case ProgressFileDone:
+		var duration time.Duration
+		if file, found := p.files[key]; found {
+			duration = now.Sub(file.start)
+			delete(p.files, key)
+		}
+		p.logger.Info("downloaded file", "repo", event.Repo, "file", event.File, "bytes", event.TotalBytes,
+			"duration", duration)
+	case ProgressError:
+		delete(p.files, key)
+		p.logger.Error("download failed", "repo", event.Repo, "file", event.File, "error", event.Err)
+	case ProgressDone:
+		if done.files > 0 {
+			p.logger.Info("downloaded files", "repo", event.Repo, "files", done.files, "bytes", done.bytes)
+		}
+	}
+}
+
+// defaultTerminalProgress is shared by all Repos drawing progress bars, see Repo.WithProgressBar.
+var defaultTerminalProgress = sync.OnceValue(func() ProgressReporter { return NewTerminalProgress(os.Stdout) })
+
+// getProgressReporter returns the ProgressReporter configured with Repo.WithProgressReporter, or the default one:
+// progress bars if the standard output is a terminal, or otherwise log records to the Repo's logger
+// (see Repo.WithLogger).
+func (r *Repo) getProgressReporter() ProgressReporter {
+	switch {
+	case r.progressReporter != nil:
+		return r.progressReporter
+	case r.Verbosity <= 0:
+		return NoProgress{}
+	case r.useProgressBar && isTerminal(os.Stdout):
+		return defaultTerminalProgress()
+	default:
+		return NewLogProgress(r.levelLogger(), 0)
+	}
+}
+
+// isTerminal returns whether the file is a terminal (character device).
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
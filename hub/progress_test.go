@@ -0,0 +1,110 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFileServer serves the contents of the files of the repository "owner/model" at the given commit-hash.
+func newTestFileServer(t *testing.T, commitHash string, contents map[string][]byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fileName, found := strings.CutPrefix(r.URL.Path, "/owner/model/resolve/"+commitHash+"/")
+		content, exists := contents[fileName]
+		if !found || !exists {
+			w.Header().Set("X-Error-Code", "EntryNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"`+sha256Hex(content)+`"`)
+		w.Header().Set(HeaderXRepoCommit, commitHash)
+		http.ServeContent(w, r, fileName, time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProgressReporter(t *testing.T) {
+	const commitHash = "0123456789abcdef0123456789abcdef01234567"
+	contents := map[string][]byte{
+		"config.json":       []byte("{}"),
+		"model.safetensors": bytes.Repeat([]byte("x"), 10_000),
+	}
+	server := newTestFileServer(t, commitHash, contents)
+
+	events := make(chan ProgressEvent, 100)
+	repo := New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint(server.URL).WithRevision(commitHash).
+		WithProgressReporter(NewChannelProgress(events))
+	_, err := repo.DownloadFiles("config.json", "model.safetensors")
+	require.NoError(t, err)
+	close(events)
+	var fileDone []string
+	var last ProgressEvent
+	for event := range events {
+		assert.Equal(t, "owner/model", event.Repo)
+		if event.Kind == ProgressFileDone {
+			fileDone = append(fileDone, event.File)
+			assert.Equal(t, int64(len(contents[event.File])), event.TotalBytes)
+		}
+		last = event
+	}
+	assert.ElementsMatch(t, []string{"config.json", "model.safetensors"}, fileDone)
+	assert.Equal(t, ProgressDone, last.Kind)
+	assert.Equal(t, int64(10_002), last.TotalBytes)
+	assert.NoError(t, last.Err)
+
+	// Cached files, and a missing one.
+	events = make(chan ProgressEvent, 100)
+	repo.WithProgressReporter(NewChannelProgress(events))
+	_, err = repo.DownloadFilesContext(context.Background(), "config.json", "missing.json")
+	require.ErrorIs(t, err, ErrEntryNotFound)
+	close(events)
+	var kinds []ProgressEventKind
+	for event := range events {
+		kinds = append(kinds, event.Kind)
+	}
+	assert.Equal(t, []ProgressEventKind{ProgressCacheHit, ProgressError, ProgressDone}, kinds)
+
+	// Invalid file name after a file to download: no download is started, and ProgressDone is the last event.
+	events = make(chan ProgressEvent, 100)
+	repo = New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint(server.URL).WithRevision(commitHash).
+		WithProgressReporter(NewChannelProgress(events))
+	_, err = repo.DownloadFiles("model.safetensors", "..")
+	require.Error(t, err)
+	close(events)
+	kinds = nil
+	for event := range events {
+		kinds = append(kinds, event.Kind)
+	}
+	assert.Equal(t, []ProgressEventKind{ProgressDone}, kinds)
+}
+
+func TestTerminalProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewTerminalProgress(&buf)
+	p.Report(ProgressEvent{Kind: ProgressDownloading, Repo: "owner/model", File: "a.bin", TotalBytes: 1000, DoneBytes: 500})
+	assert.Equal(t, "a.bin [===============               ] 50% of 1.0 kB\n", buf.String())
+
+	buf.Reset()
+	p.Report(ProgressEvent{Kind: ProgressDownloading, Repo: "owner/model", File: "b.bin", TotalBytes: 2000,
+		Rate: 1000, ETA: 2 * time.Second})
+	assert.Equal(t, "\x1b[1A\r\x1b[J"+
+		"a.bin [===============               ] 50% of 1.0 kB\n"+
+		"b.bin [                              ] 0% of 2.0 kB, 1.0 kB/s, ETA 2s\n", buf.String())
+
+	buf.Reset()
+	p.Report(ProgressEvent{Kind: ProgressFileDone, Repo: "owner/model", File: "a.bin", TotalBytes: 1000, DoneBytes: 1000})
+	p.Report(ProgressEvent{Kind: ProgressDone, Repo: "owner/model", TotalBytes: 3000})
+	assert.Equal(t, "\x1b[2A\r\x1b[J"+
+		"a.bin: downloaded 1.0 kB\n"+
+		"b.bin [                              ] 0% of 2.0 kB, 1.0 kB/s, ETA 2s\n"+
+		"\x1b[1A\r\x1b[J"+
+		"Downloaded 1 files (3.0 kB) from owner/model\n", buf.String())
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package hub
+
+import (
+	"os"
+	"syscall"
+)
+
+// ioctlFICLONE is the Linux FICLONE ioctl request, to share the contents of a file (copy-on-write) in file systems
+// that support it (e.g.: btrfs, xfs).
+const ioctlFICLONE = 0x40049409
+
+// reflink creates dst as a copy-on-write clone of src, if supported by the file system.
+func reflink(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = srcFile.Close() }()
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, DefaultFileCreationPerm)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dstFile.Fd(), ioctlFICLONE, srcFile.Fd())
+	errClose := dstFile.Close()
+	if errno != 0 {
+		_ = os.Remove(dst)
+		return errno
+	}
+	if errClose != nil {
+		_ = os.Remove(dst)
+		return errClose
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package hub
+
+import "github.com/pkg/errors"
+
+// reflink is not supported in this platform.
+func reflink(src, dst string) error {
+	return errors.New("reflink not supported")
+}
@@ -0,0 +1,84 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/url"
+	"time"
+)
+
+// GitRef is a branch, tag, convert or pull request of a repository.
+type GitRef struct {
+	// Name of the reference, e.g.: "main" or "v1.0". It can be used with Repo.WithRevision.
+	Name string `json:"name"`
+
+	// Ref is the full git reference, e.g.: "refs/heads/main", "refs/tags/v1.0" or "refs/pr/1".
+	Ref string `json:"ref"`
+
+	// TargetCommit is the commit-hash the reference points to.
+	TargetCommit string `json:"targetCommit"`
+}
+
+// GitRefs of a repository, as returned by Repo.ListRefs.
+type GitRefs struct {
+	Branches []*GitRef `json:"branches"`
+	Tags     []*GitRef `json:"tags"`
+
+	// Converts are the branches created by HuggingFace Hub with converted versions of the repository
+	// (e.g.: "parquet" for datasets).
+	Converts []*GitRef `json:"converts"`
+
+	// PullRequests open or closed for the repository. Use their Ref (e.g.: "refs/pr/1") as the revision.
+	PullRequests []*GitRef `json:"pullRequests"`
+}
+
+// GitCommit is an entry in the history of a repository, as returned by Repo.IterCommits.
+type GitCommit struct {
+	// ID is the commit-hash.
+	ID      string          `json:"id"`
+	Title   string          `json:"title"`
+	Message string          `json:"message"`
+	Authors []*CommitAuthor `json:"authors"`
+	Date    time.Time       `json:"date"`
+}
+
+// CommitAuthor of a GitCommit.
+type CommitAuthor struct {
+	// User name in HuggingFace Hub.
+	User   string `json:"user"`
+	Avatar string `json:"avatar"`
+}
+
+// ListRefs returns the branches, tags, converts and pull requests of the repository.
+//
+// It requires access to the HuggingFace Hub: in offline mode (see Repo.WithOffline), it returns an error wrapping
+// ErrOfflineNotCached.
+func (r *Repo) ListRefs() (*GitRefs, error) {
+	return r.ListRefsContext(context.Background())
+}
+
+// ListRefsContext is like ListRefs, but the request can be cancelled with ctx.
+func (r *Repo) ListRefsContext(ctx context.Context) (*GitRefs, error) {
+	refsURL := r.apiURL() + "/refs?include_prs=1"
+	refs := &GitRefs{}
+	if err := fetchAPI(ctx, r, refsURL, refs); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// IterCommits iterates over the history of the revision of the repository (see Repo.WithRevision), from the most
+// recent commit to the oldest. The commits are fetched one page at a time, as the iteration progresses.
+//
+// It requires access to the HuggingFace Hub: in offline mode (see Repo.WithOffline), it yields an error wrapping
+// ErrOfflineNotCached.
+func (r *Repo) IterCommits() iter.Seq2[*GitCommit, error] {
+	return r.IterCommitsContext(context.Background())
+}
+
+// IterCommitsContext is like IterCommits, but the requests can be cancelled with ctx.
+func (r *Repo) IterCommitsContext(ctx context.Context) iter.Seq2[*GitCommit, error] {
+	commitsURL := fmt.Sprintf("%s/commits/%s", r.apiURL(), url.PathEscape(r.revision))
+	return iterAPIPages[*GitCommit](ctx, r, commitsURL)
+}
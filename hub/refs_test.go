@@ -0,0 +1,64 @@
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListRefs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/models/owner/model/refs", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("include_prs"))
+		_, _ = fmt.Fprint(w, `{
+			"branches": [{"name": "main", "ref": "refs/heads/main", "targetCommit": "1111111111111111111111111111111111111111"}],
+			"converts": [],
+			"tags": [{"name": "v1.0", "ref": "refs/tags/v1.0", "targetCommit": "2222222222222222222222222222222222222222"}],
+			"pullRequests": [{"name": "1", "ref": "refs/pr/1", "targetCommit": "3333333333333333333333333333333333333333"}]
+		}`)
+	}))
+	defer server.Close()
+
+	repo := New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint(server.URL)
+	refs, err := repo.ListRefs()
+	require.NoError(t, err)
+	require.Len(t, refs.Branches, 1)
+	assert.Equal(t, "main", refs.Branches[0].Name)
+	require.Len(t, refs.Tags, 1)
+	assert.Equal(t, "2222222222222222222222222222222222222222", refs.Tags[0].TargetCommit)
+	assert.Empty(t, refs.Converts)
+	require.Len(t, refs.PullRequests, 1)
+	assert.Equal(t, "refs/pr/1", refs.PullRequests[0].Ref)
+}
+
+func TestIterCommits(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/models/owner/model/commits/v1.0", r.URL.Path)
+		if r.URL.Query().Get("p") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?p=1>; rel="next"`, server.URL, r.URL.Path))
+			_, _ = fmt.Fprint(w, `[{"id": "2222222222222222222222222222222222222222", "title": "Second",
+				"authors": [{"user": "alice"}], "date": "2024-05-02T10:00:00.000Z"}]`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `[{"id": "1111111111111111111111111111111111111111", "title": "Initial commit",
+			"authors": [{"user": "bob"}], "date": "2024-05-01T10:00:00.000Z"}]`)
+	}))
+	defer server.Close()
+
+	repo := New("owner/model").WithCacheDir(t.TempDir()).WithEndpoint(server.URL).WithRevision("v1.0")
+	var commits []*GitCommit
+	for commit, err := range repo.IterCommits() {
+		require.NoError(t, err)
+		commits = append(commits, commit)
+	}
+	require.Len(t, commits, 2)
+	assert.Equal(t, "Second", commits[0].Title)
+	assert.Equal(t, "alice", commits[0].Authors[0].User)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), commits[1].Date)
+}
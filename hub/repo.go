@@ -1,11 +1,14 @@
 package hub
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/gomlx/go-huggingface/internal/downloader"
 	"github.com/gomlx/go-huggingface/internal/files"
@@ -46,13 +49,37 @@ type Repo struct {
 
 	downloadManager *downloader.Manager
 
+	// sharedDownloadManager is true if downloadManager was set with WithDownloadManager, as opposed to created by
+	// the Repo. In which case the Repo doesn't change its configuration.
+	sharedDownloadManager bool
+
+	// httpClient used by the download manager, if not nil. See WithHTTPClient.
+	httpClient *http.Client
+
 	useProgressBar bool
+
+	// progressReporter receives the progress of downloads, if not nil. See WithProgressReporter.
+	progressReporter ProgressReporter
+
+	// logger used by the Repo, if not nil. See WithLogger.
+	logger *slog.Logger
+
+	// offline mode: only the cache is used, no HTTP requests are made.
+	offline bool
+
+	// cacheLimit in bytes for the whole cacheDir, if > 0. See WithCacheLimit.
+	cacheLimit int64
+
+	// etagTimeout and downloadTimeout configure the download manager created for the Repo, see Settings.
+	etagTimeout, downloadTimeout time.Duration
 }
 
-// New creates a reference to a HuggingFace model given its id.
+// New creates a reference to a HuggingFace model given its id, configured with the Settings loaded from the
+// environment variables by SettingsFromEnv, the same used by huggingface_hub python library (HF_ENDPOINT, HF_HOME,
+// HF_HUB_CACHE, HF_TOKEN, HF_HUB_OFFLINE, etc.).
 //
-// It uses the default cache directory in ${XDG_CACHE_HOME} (if set) or `~/.cache`, in a format that is
-// shared with huggingface-hub for python library. The cache is share across various programs, including Python
+// It uses the default cache directory (see DefaultCacheDir), typically `~/.cache/huggingface/hub`, in a format that
+// is shared with huggingface-hub for python library. The cache is share across various programs, including Python
 // programs.
 // Use Repo.WithCacheDir to change it, or NewWithDir to use a plain directory structure, that is not shared across programs.
 //
@@ -60,22 +87,34 @@ type Repo struct {
 //
 // It defaults to being a RepoTypeModel repository. But you can change it with Repo.WithType.
 //
-// If authentication is needed, use Repo.WithAuth.
+// The authentication token is taken from HF_TOKEN or from the token file saved by `huggingface-cli login`, if
+// available. Use Repo.WithAuth to change it.
 func New(id string) *Repo {
-	hfEndpoint := os.Getenv("HF_ENDPOINT")
-	if hfEndpoint == "" {
-		hfEndpoint = "https://huggingface.co"
-	} else {
-		hfEndpoint = strings.TrimSuffix(hfEndpoint, "/")
-	}
+	return NewWithSettings(id, SettingsFromEnv())
+}
+
+// NewWithSettings creates a reference to a HuggingFace model given its id, like New, but configured with the given
+// settings instead of the ones loaded from the environment.
+//
+// Empty fields of settings are filled with the defaults, so a partial Settings{} can be given: DefaultEndpoint,
+// the cache directory `${Home}/hub` (or DefaultCacheDir if Home is also empty), DefaultEtagTimeout and
+// DefaultDownloadTimeout. To start from the environment configuration, modify the Settings returned by
+// SettingsFromEnv instead.
+func NewWithSettings(id string, settings Settings) *Repo {
+	settings = settings.withDefaults()
 	return &Repo{
 		ID:                  id,
 		repoType:            RepoTypeModel,
 		revision:            "main",
-		hfEndpoint:          hfEndpoint,
-		cacheDir:            DefaultCacheDir(),
+		hfEndpoint:          settings.Endpoint,
+		cacheDir:            settings.CacheDir,
+		authToken:           settings.Token,
 		Verbosity:           1,
 		MaxParallelDownload: 20, // At most 20 parallel downloads.
+		useProgressBar:      !settings.DisableProgressBars,
+		offline:             settings.Offline,
+		etagTimeout:         settings.EtagTimeout,
+		downloadTimeout:     settings.DownloadTimeout,
 	}
 }
 
@@ -107,13 +146,13 @@ func (r *Repo) WithRevision(revision string) *Repo {
 
 // WithCacheDir sets the cacheDir to the given directory.
 //
-// The default is given by DefaultCacheDir: `${XDG_CACHE_HOME}/huggingface/hub` if set, or `~/.cache/huggingface/hub` otherwise.
+// The default is given by DefaultCacheDir, typically `~/.cache/huggingface/hub`.
 func (r *Repo) WithCacheDir(cacheDir string) *Repo {
 	newCacheDir, err := files.ReplaceTildeInDir(cacheDir)
 	if err == nil {
 		r.cacheDir = path.Clean(newCacheDir)
 	} else {
-		log.Printf("Failed to resolve directory for %q: %+v", cacheDir, err)
+		r.getLogger().Error("failed to resolve cache directory", "dir", cacheDir, "error", err)
 	}
 	return r
 }
@@ -123,15 +162,67 @@ func (r *Repo) WithCacheDir(cacheDir string) *Repo {
 // This is useful when downloading multiple Repos simultaneously, to coordinate limits by sharing the download manager.
 func (r *Repo) WithDownloadManager(manager *downloader.Manager) *Repo {
 	r.downloadManager = manager
+	r.sharedDownloadManager = manager != nil
 	return r
 }
 
-// WithProgressBar configures the usage of progress bar during download. Defaults to true.
+// WithHTTPClient sets the http.Client used for all requests to HuggingFace Hub, e.g. to go through a proxy, to use
+// TLS certificates of an internal mirror, or to use a custom http.RoundTripper in tests.
+//
+// By default, a client shared by all Repos is used, which follows the proxy configuration in the environment
+// (HTTPS_PROXY, NO_PROXY, etc.).
+// The client's CheckRedirect is ignored, and its Timeout should be left at 0 to allow the download of large files.
+//
+// It doesn't apply to a download manager set with Repo.WithDownloadManager, which may be shared with other Repos:
+// configure the client of the shared manager instead, with downloader.Manager.WithHTTPClient.
+func (r *Repo) WithHTTPClient(client *http.Client) *Repo {
+	r.httpClient = client
+	if r.downloadManager != nil && !r.sharedDownloadManager {
+		r.downloadManager.WithHTTPClient(client)
+	}
+	return r
+}
+
+// WithProgressBar configures the usage of progress bar during download. Defaults to true, unless the environment
+// variable HF_HUB_DISABLE_PROGRESS_BARS is set to true (e.g.: "1").
+//
+// Progress bars are only drawn if Verbosity > 0 and the standard output is a terminal, otherwise the progress is
+// logged to the Repo's logger (see Repo.WithLogger and NewLogProgress). It has no effect if a reporter is set with Repo.WithProgressReporter.
 func (r *Repo) WithProgressBar(useProgressBar bool) *Repo {
 	r.useProgressBar = useProgressBar
 	return r
 }
 
+// WithProgressReporter sets the ProgressReporter that receives the progress of downloads, e.g. NewChannelProgress
+// to update a GUI. It can be shared by Repos downloading at the same time.
+//
+// If not set (or set to nil), the progress is reported according to Verbosity and Repo.WithProgressBar.
+func (r *Repo) WithProgressReporter(reporter ProgressReporter) *Repo {
+	r.progressReporter = reporter
+	return r
+}
+
+// WithOffline configures the offline mode, in which no HTTP requests are made, and only the files already in the
+// cache are used. Defaults to false, unless the environment variable HF_HUB_OFFLINE (or TRANSFORMERS_OFFLINE) is
+// set to true (e.g.: "1").
+//
+// In offline mode, the revision is resolved to a commit-hash using only the cache (the "refs/<revision>" files and
+// the existing snapshots), and requests for anything not in the cache return an error wrapping ErrOfflineNotCached.
+func (r *Repo) WithOffline(offline bool) *Repo {
+	r.offline = offline
+	return r
+}
+
+// WithCacheLimit sets the maximum size in bytes of the cache directory (all repositories in it, not only this one).
+// After Repo.DownloadFiles downloads new files, the least-recently-used revisions are evicted until the cache is
+// within the limit, except the files being returned, and files being downloaded by other programs. See EvictCache.
+//
+// If set to <= 0 (the default), there is no limit.
+func (r *Repo) WithCacheLimit(maxBytes int64) *Repo {
+	r.cacheLimit = maxBytes
+	return r
+}
+
 // flatFolderName returns a serialized version of a hf.co repo name and type, safe for disk storage
 // as a single non-nested folder.
 //
@@ -162,36 +253,99 @@ func (r *Repo) RepoCacheDir() string {
 //
 // Usually, not used directly (use DownloadFile instead), but in case someone needs for debugging.
 func (r *Repo) FileURL(fileName string) (string, error) {
-	commitHash, err := r.readCommitHashForRevision()
+	return r.fileURL(context.Background(), fileName)
+}
+
+// fileURL implements FileURL.
+func (r *Repo) fileURL(ctx context.Context, fileName string) (string, error) {
+	commitHash, err := r.readCommitHashForRevision(ctx)
 	if err != nil {
 		return "", err
 	}
+	return fmt.Sprintf("%s/resolve/%s/%s", r.repoURL(), commitHash, fileName), nil
+}
+
+// repoURL returns the URL of the repository in HuggingFace Hub, e.g.: "https://huggingface.co/datasets/owner/name".
+// Models have no repository type prefix.
+func (r *Repo) repoURL() string {
 	if r.repoType == RepoTypeModel {
-		return fmt.Sprintf("%s/%s/resolve/%s/%s", r.hfEndpoint, r.ID, commitHash, fileName), nil
-	} else {
-		return fmt.Sprintf("%s/%s/%s/resolve/%s/%s", r.hfEndpoint, r.repoType, r.ID, commitHash, fileName), nil
+		return fmt.Sprintf("%s/%s", r.hfEndpoint, r.ID)
 	}
+	return fmt.Sprintf("%s/%s/%s", r.hfEndpoint, r.repoType, r.ID)
+}
+
+// apiURL returns the URL of the HuggingFace Hub API for the repository, e.g.: "https://huggingface.co/api/models/owner/name".
+func (r *Repo) apiURL() string {
+	return fmt.Sprintf("%s/api/%s/%s", r.hfEndpoint, r.repoType, r.ID)
 }
 
 // readCommitHashForRevision finds the commit-hash for the revision, it should already be written to disk.
 // The revision can be itself a commit-hash, in which case it is returned directly.
 //
-// repoCacheDir is returned by Repo.repoCacheDir().
-func (r *Repo) readCommitHashForRevision() (string, error) {
-	err := r.DownloadInfo(false)
+// Otherwise, it is always the commit-hash of the info of the repository (see Repo.DownloadInfo), so the URLs and
+// snapshot directories used agree with Repo.Info. In offline mode, the info is resolved with the "refs/<revision>"
+// file in the repository cache directory, in the same format used by huggingface_hub, so resolutions are shared with
+// Python programs.
+func (r *Repo) readCommitHashForRevision(ctx context.Context) (string, error) {
+	if isCommitHash(r.revision) {
+		return r.revision, nil
+	}
+	err := r.DownloadInfoContext(ctx, false)
 	if err != nil {
 		return "", err
 	}
 	return r.info.CommitHash, nil
 }
 
+// refPath returns the path of the file "refs/<revision>" that holds the commit-hash for the revision, as used by
+// huggingface_hub. Revisions with "/" (e.g.: "refs/pr/1") are stored in subdirectories.
+func (r *Repo) refPath() string {
+	return path.Join(r.RepoCacheDir(), "refs", cleanRelativeFilePath(r.revision))
+}
+
+// readRef reads the commit-hash for the revision from the "refs/<revision>" file, if it exists and is valid.
+func (r *Repo) readRef() (commitHash string, found bool) {
+	contents, err := os.ReadFile(r.refPath())
+	if err != nil {
+		return "", false
+	}
+	commitHash = strings.TrimSpace(string(contents))
+	if !isCommitHash(commitHash) {
+		return "", false
+	}
+	return commitHash, true
+}
+
+// writeRef writes the commit-hash for the revision to the "refs/<revision>" file, in the same format used by
+// huggingface_hub. Nothing is written if the revision is itself a commit-hash.
+//
+// It writes to a temporary file first, and atomically moves it in place, so concurrent readers never see a partial file.
+func (r *Repo) writeRef(commitHash string) error {
+	if isCommitHash(r.revision) || commitHash == r.revision {
+		return nil
+	}
+	refPath := r.refPath()
+	if err := os.MkdirAll(path.Dir(refPath), DefaultDirCreationPerm); err != nil {
+		return errors.Wrapf(err, "while creating refs directory %q", path.Dir(refPath))
+	}
+	tmpPath := fmt.Sprintf("%s.%s.tmp", refPath, SessionId)
+	if err := os.WriteFile(tmpPath, []byte(commitHash), DefaultFileCreationPerm); err != nil {
+		return errors.Wrapf(err, "while writing ref file %q", tmpPath)
+	}
+	if err := os.Rename(tmpPath, refPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "while moving ref file %q to %q", tmpPath, refPath)
+	}
+	return nil
+}
+
 // repoSnapshotsDir returns the snapshots directory for this repo at its revision.
-func (r *Repo) repoSnapshotsDir() (string, error) {
+func (r *Repo) repoSnapshotsDir(ctx context.Context) (string, error) {
 	cacheDir, err := r.repoCacheDir()
 	if err != nil {
 		return "", err
 	}
-	commitHash, err := r.readCommitHashForRevision()
+	commitHash, err := r.readCommitHashForRevision(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,142 @@
+package hub
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomlx/go-huggingface/internal/files"
+)
+
+const (
+	// DefaultEndpoint of the HuggingFace Hub.
+	DefaultEndpoint = "https://huggingface.co"
+
+	// DefaultEtagTimeout is the default timeout for requests of file metadata, same as the python library.
+	DefaultEtagTimeout = 10 * time.Second
+
+	// DefaultDownloadTimeout is the default time to wait for a server to send data while downloading a file,
+	// same as the python library.
+	DefaultDownloadTimeout = 10 * time.Second
+)
+
+// Settings holds the configuration shared by Repos, usually loaded from the environment variables
+// used by huggingface_hub python library with SettingsFromEnv. It is used as the defaults of New.
+//
+// See https://huggingface.co/docs/huggingface_hub/package_reference/environment_variables
+type Settings struct {
+	// Endpoint of the HuggingFace Hub, without the trailing "/". Env: HF_ENDPOINT.
+	Endpoint string
+
+	// Home is the directory where huggingface_hub stores its files (the cache, the token, etc.).
+	// Env: HF_HOME, defaults to `${XDG_CACHE_HOME}/huggingface` or `~/.cache/huggingface`.
+	Home string
+
+	// CacheDir where the downloaded files are stored. Env: HF_HUB_CACHE or HUGGINGFACE_HUB_CACHE, defaults to
+	// `${Home}/hub`.
+	CacheDir string
+
+	// Token used for authentication. Env: HF_TOKEN or HUGGING_FACE_HUB_TOKEN, and if not set, the contents of the
+	// TokenPath file (created by `huggingface-cli login`).
+	Token string
+
+	// TokenPath is the file from where the Token is read, if not given in the environment.
+	// Env: HF_TOKEN_PATH, defaults to `${Home}/token`.
+	TokenPath string
+
+	// DisableProgressBars turns off progress bars (see Repo.WithProgressBar). Env: HF_HUB_DISABLE_PROGRESS_BARS.
+	DisableProgressBars bool
+
+	// EtagTimeout is the timeout for requests of file metadata. Env: HF_HUB_ETAG_TIMEOUT, in seconds.
+	// If 0, DefaultEtagTimeout is used, and if negative, there is no timeout.
+	EtagTimeout time.Duration
+
+	// DownloadTimeout is the maximum time to wait for a server to send data while downloading a file: it's not a
+	// limit on the total time of the download. Env: HF_HUB_DOWNLOAD_TIMEOUT, in seconds.
+	// If 0, DefaultDownloadTimeout is used, and if negative, there is no timeout.
+	DownloadTimeout time.Duration
+
+	// Offline mode, see Repo.WithOffline. Env: HF_HUB_OFFLINE or TRANSFORMERS_OFFLINE, either of them being true
+	// is enough.
+	Offline bool
+}
+
+// SettingsFromEnv loads the Settings from the environment variables, with the same precedence rules and defaults
+// as huggingface_hub python library.
+//
+// Boolean variables are true if set to one of "1", "ON", "YES" or "TRUE" (case-insensitive). Invalid timeouts are
+// ignored, and the defaults are used.
+func SettingsFromEnv() Settings {
+	s := Settings{
+		Endpoint:            strings.TrimSuffix(getEnvOr("HF_ENDPOINT", DefaultEndpoint), "/"),
+		Home:                defaultHome(),
+		CacheDir:            DefaultCacheDir(),
+		DisableProgressBars: isTrue(os.Getenv("HF_HUB_DISABLE_PROGRESS_BARS")),
+		EtagTimeout:         getEnvSeconds("HF_HUB_ETAG_TIMEOUT", DefaultEtagTimeout),
+		DownloadTimeout:     getEnvSeconds("HF_HUB_DOWNLOAD_TIMEOUT", DefaultDownloadTimeout),
+		Offline:             isTrue(os.Getenv("HF_HUB_OFFLINE")) || isTrue(os.Getenv("TRANSFORMERS_OFFLINE")),
+	}
+	s.TokenPath = expandHome(getEnvOr("HF_TOKEN_PATH", path.Join(s.Home, "token")))
+	s.Token = strings.TrimSpace(getEnvOr("HF_TOKEN", os.Getenv("HUGGING_FACE_HUB_TOKEN")))
+	if s.Token == "" {
+		if content, err := os.ReadFile(s.TokenPath); err == nil {
+			s.Token = strings.TrimSpace(string(content))
+		}
+	}
+	return s
+}
+
+// withDefaults returns a copy of the settings with the empty fields filled with the defaults: DefaultEndpoint,
+// DefaultEtagTimeout, DefaultDownloadTimeout, and the cache directory `${Home}/hub` (or DefaultCacheDir if Home
+// is also empty). The Token is not read from TokenPath.
+func (s Settings) withDefaults() Settings {
+	if s.Endpoint == "" {
+		s.Endpoint = DefaultEndpoint
+	}
+	s.Endpoint = strings.TrimSuffix(s.Endpoint, "/")
+	if s.CacheDir == "" {
+		if s.Home != "" {
+			s.CacheDir = path.Join(expandHome(s.Home), "hub")
+		} else {
+			s.CacheDir = DefaultCacheDir()
+		}
+	}
+	s.CacheDir = path.Clean(expandHome(s.CacheDir))
+	if s.EtagTimeout == 0 {
+		s.EtagTimeout = DefaultEtagTimeout
+	}
+	if s.DownloadTimeout == 0 {
+		s.DownloadTimeout = DefaultDownloadTimeout
+	}
+	return s
+}
+
+// defaultHome returns the huggingface_hub home directory: `${HF_HOME}` if set, or otherwise `huggingface` under
+// `${XDG_CACHE_HOME}` or `~/.cache`.
+func defaultHome() string {
+	if home := os.Getenv("HF_HOME"); home != "" {
+		return expandHome(home)
+	}
+	cacheDir := getEnvOr("XDG_CACHE_HOME", path.Join(os.Getenv("HOME"), ".cache"))
+	return expandHome(path.Join(cacheDir, "huggingface"))
+}
+
+// expandHome replaces a leading "~" in dir by the user's home directory, and leaves dir unchanged if it fails.
+func expandHome(dir string) string {
+	if expanded, err := files.ReplaceTildeInDir(dir); err == nil {
+		return expanded
+	}
+	return dir
+}
+
+// getEnvSeconds parses the environment variable key as an integer number of seconds, and returns defaultValue
+// if it is not set or invalid.
+func getEnvSeconds(key string, defaultValue time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil || seconds <= 0 {
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,118 @@
+package hub
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearSettingsEnv unsets (for the duration of the test) the environment variables read by SettingsFromEnv.
+func clearSettingsEnv(t *testing.T) {
+	for _, key := range []string{"HF_ENDPOINT", "HF_HOME", "XDG_CACHE_HOME", "HF_HUB_CACHE", "HUGGINGFACE_HUB_CACHE",
+		"HF_TOKEN", "HUGGING_FACE_HUB_TOKEN", "HF_TOKEN_PATH", "HF_HUB_DISABLE_PROGRESS_BARS", "HF_HUB_ETAG_TIMEOUT",
+		"HF_HUB_DOWNLOAD_TIMEOUT", "HF_HUB_OFFLINE", "TRANSFORMERS_OFFLINE"} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestSettingsFromEnv(t *testing.T) {
+	clearSettingsEnv(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	s := SettingsFromEnv()
+	assert.Equal(t, Settings{
+		Endpoint:        DefaultEndpoint,
+		Home:            path.Join(home, ".cache", "huggingface"),
+		CacheDir:        path.Join(home, ".cache", "huggingface", "hub"),
+		TokenPath:       path.Join(home, ".cache", "huggingface", "token"),
+		EtagTimeout:     DefaultEtagTimeout,
+		DownloadTimeout: DefaultDownloadTimeout,
+	}, s)
+	assert.Equal(t, s.CacheDir, DefaultCacheDir())
+
+	// XDG_CACHE_HOME, and the token from the token file.
+	xdgCache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", xdgCache)
+	require.NoError(t, os.MkdirAll(path.Join(xdgCache, "huggingface"), DefaultDirCreationPerm))
+	require.NoError(t, os.WriteFile(path.Join(xdgCache, "huggingface", "token"), []byte("hf_file\n"), DefaultFileCreationPerm))
+	s = SettingsFromEnv()
+	assert.Equal(t, path.Join(xdgCache, "huggingface", "hub"), s.CacheDir)
+	assert.Equal(t, "hf_file", s.Token)
+
+	// HF_HOME takes precedence over XDG_CACHE_HOME, and HUGGING_FACE_HUB_TOKEN over the token file.
+	t.Setenv("HF_HOME", "/hf/home")
+	t.Setenv("HUGGING_FACE_HUB_TOKEN", "hf_legacy")
+	s = SettingsFromEnv()
+	assert.Equal(t, "/hf/home", s.Home)
+	assert.Equal(t, "/hf/home/hub", s.CacheDir)
+	assert.Equal(t, "/hf/home/token", s.TokenPath)
+	assert.Equal(t, "hf_legacy", s.Token)
+
+	// Explicit cache, token and token path, and the other settings.
+	t.Setenv("HUGGINGFACE_HUB_CACHE", "/legacy/cache")
+	assert.Equal(t, "/legacy/cache", SettingsFromEnv().CacheDir)
+	t.Setenv("HF_HUB_CACHE", "/hub/cache")
+	t.Setenv("HF_TOKEN", " hf_token ")
+	t.Setenv("HF_TOKEN_PATH", "/my/token")
+	t.Setenv("HF_ENDPOINT", "https://mirror.example.com/")
+	t.Setenv("HF_HUB_DISABLE_PROGRESS_BARS", "yes")
+	t.Setenv("HF_HUB_ETAG_TIMEOUT", "3")
+	t.Setenv("HF_HUB_DOWNLOAD_TIMEOUT", "not a number")
+	t.Setenv("TRANSFORMERS_OFFLINE", "1")
+	s = SettingsFromEnv()
+	assert.Equal(t, Settings{
+		Endpoint:            "https://mirror.example.com",
+		Home:                "/hf/home",
+		CacheDir:            "/hub/cache",
+		Token:               "hf_token",
+		TokenPath:           "/my/token",
+		DisableProgressBars: true,
+		EtagTimeout:         3 * time.Second,
+		DownloadTimeout:     DefaultDownloadTimeout,
+		Offline:             true,
+	}, s)
+	assert.Equal(t, "/hub/cache", DefaultCacheDir())
+
+	// New uses the settings from the environment.
+	repo := New("owner/model")
+	assert.Equal(t, "https://mirror.example.com", repo.hfEndpoint)
+	assert.Equal(t, "/hub/cache", repo.cacheDir)
+	assert.Equal(t, "hf_token", repo.authToken)
+	assert.False(t, repo.useProgressBar)
+	assert.True(t, repo.offline)
+	assert.Equal(t, 3*time.Second, repo.etagTimeout)
+
+	// Either HF_HUB_OFFLINE or TRANSFORMERS_OFFLINE turn on the offline mode.
+	t.Setenv("HF_HUB_OFFLINE", "0")
+	assert.True(t, SettingsFromEnv().Offline)
+	t.Setenv("TRANSFORMERS_OFFLINE", "0")
+	assert.False(t, SettingsFromEnv().Offline)
+	t.Setenv("HF_HUB_OFFLINE", "1")
+	assert.True(t, SettingsFromEnv().Offline)
+}
+
+func TestNewWithSettings(t *testing.T) {
+	clearSettingsEnv(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// Empty settings use the defaults.
+	repo := NewWithSettings("owner/model", Settings{})
+	assert.Equal(t, DefaultEndpoint, repo.hfEndpoint)
+	assert.Equal(t, DefaultCacheDir(), repo.cacheDir)
+	assert.Equal(t, DefaultEtagTimeout, repo.etagTimeout)
+	assert.Equal(t, DefaultDownloadTimeout, repo.downloadTimeout)
+	assert.Equal(t, "", repo.authToken)
+	assert.True(t, repo.useProgressBar)
+
+	// Partial settings.
+	repo = NewWithSettings("owner/model", Settings{Endpoint: "https://mirror.example.com/", Home: "/hf/home",
+		DownloadTimeout: -1})
+	assert.Equal(t, "https://mirror.example.com", repo.hfEndpoint)
+	assert.Equal(t, "/hf/home/hub", repo.cacheDir)
+	assert.Equal(t, time.Duration(-1), repo.downloadTimeout)
+}
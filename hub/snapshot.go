@@ -0,0 +1,161 @@
+package hub
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SnapshotOptions for Repo.DownloadSnapshot.
+type SnapshotOptions struct {
+	// AllowPatterns, if not empty, select the files to download: only files matching at least one of the
+	// patterns are downloaded.
+	AllowPatterns []string
+
+	// IgnorePatterns select files not to download, even if they match AllowPatterns.
+	IgnorePatterns []string
+
+	// HardLinks makes Repo.DownloadToDir hard-link the files from the cache, when dir is on the same file system,
+	// instead of reflinking or copying them. Hard-linked files share their contents with the cache, so modifying
+	// them in place corrupts the cache: they should only be replaced.
+	HardLinks bool
+}
+
+// DownloadSnapshot downloads the files of the repository selected by the options, and returns the snapshot directory
+// in the cache where they can be read. It is the equivalent of huggingface_hub's snapshot_download.
+//
+// Patterns follow the same rules as in huggingface_hub (Python's fnmatch): "*" matches any sequence of characters,
+// including "/" (so "**" is the same as "*"), "?" matches any single character, "[seq]" matches any character in
+// seq and "[!seq]" any character not in seq. Patterns ending with "/" match everything in the directory.
+//
+// Example: download only the safetensors and the tokenizer files, skipping the ones under "onnx/":
+//
+//	snapshotDir, err := repo.DownloadSnapshot(hub.SnapshotOptions{
+//		AllowPatterns:  []string{"*.safetensors", "tokenizer*"},
+//		IgnorePatterns: []string{"*.bin", "onnx/*"},
+//	})
+func (r *Repo) DownloadSnapshot(opts SnapshotOptions) (snapshotDir string, err error) {
+	return r.DownloadSnapshotContext(context.Background(), opts)
+}
+
+// DownloadSnapshotContext is like DownloadSnapshot, but it can be cancelled with ctx.
+func (r *Repo) DownloadSnapshotContext(ctx context.Context, opts SnapshotOptions) (snapshotDir string, err error) {
+	fileNames, err := r.filterFileNames(ctx, opts.AllowPatterns, opts.IgnorePatterns)
+	if err != nil {
+		return "", err
+	}
+	if _, err = r.DownloadFilesContext(ctx, fileNames...); err != nil {
+		return "", err
+	}
+	return r.repoSnapshotsDir(ctx)
+}
+
+// filterFileNames returns the file names of the repository selected by the allow and ignore patterns.
+func (r *Repo) filterFileNames(ctx context.Context, allowPatterns, ignorePatterns []string) ([]string, error) {
+	allow, err := compilePatterns(allowPatterns)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := compilePatterns(ignorePatterns)
+	if err != nil {
+		return nil, err
+	}
+	var fileNames []string
+	for fileName, err := range r.IterFileNamesContext(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		if len(allow) > 0 && !matchesAny(fileName, allow) {
+			continue
+		}
+		if matchesAny(fileName, ignore) {
+			continue
+		}
+		fileNames = append(fileNames, fileName)
+	}
+	return fileNames, nil
+}
+
+// compilePatterns converts fnmatch-style patterns to regular expressions.
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(fnmatchToRegexp(pattern))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid file pattern %q", pattern)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// matchesAny returns whether fileName matches any of the patterns.
+func matchesAny(fileName string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(fileName) {
+			return true
+		}
+	}
+	return false
+}
+
+// fnmatchToRegexp translates a pattern with the same rules as Python's fnmatch.translate, including huggingface_hub's
+// convention that patterns ending with "/" match everything in the directory.
+func fnmatchToRegexp(pattern string) string {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "*"
+	}
+	var sb strings.Builder
+	sb.WriteString("^(?s:")
+	runes := []rune(pattern)
+	for ii := 0; ii < len(runes); ii++ {
+		c := runes[ii]
+		switch c {
+		case '*':
+			// Consecutive "*" are the same as one.
+			for ii+1 < len(runes) && runes[ii+1] == '*' {
+				ii++
+			}
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			// Find the closing "]": a "]" right after "[" or "[!" is a literal.
+			jj := ii + 1
+			if jj < len(runes) && runes[jj] == '!' {
+				jj++
+			}
+			if jj < len(runes) && runes[jj] == ']' {
+				jj++
+			}
+			for jj < len(runes) && runes[jj] != ']' {
+				jj++
+			}
+			if jj >= len(runes) {
+				// No closing bracket: "[" is a literal.
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := runes[ii+1 : jj]
+			sb.WriteByte('[')
+			if len(class) > 0 && class[0] == '!' {
+				sb.WriteByte('^')
+				class = class[1:]
+			}
+			for _, cc := range class {
+				if cc == '\\' || cc == '[' || cc == ']' || cc == '^' {
+					sb.WriteByte('\\')
+				}
+				sb.WriteRune(cc)
+			}
+			sb.WriteByte(']')
+			ii = jj
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString(")$")
+	return sb.String()
+}
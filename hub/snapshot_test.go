@@ -0,0 +1,37 @@
+package hub
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFnmatchToRegexp(t *testing.T) {
+	testCases := []struct {
+		pattern, fileName string
+		expected          bool
+	}{
+		{"*.safetensors", "model.safetensors", true},
+		{"*.safetensors", "sub/model-00001.safetensors", true},
+		{"*.safetensors", "model.safetensors.index.json", false},
+		{"tokenizer*", "tokenizer_config.json", true},
+		{"tokenizer*", "sub/tokenizer.json", false},
+		{"onnx/*", "onnx/model.onnx", true},
+		{"onnx/*", "onnx/quantized/model.onnx", true},
+		{"onnx/", "onnx/model.onnx", true},
+		{"**/*.json", "a/b/config.json", true},
+		{"**/*.json", "config.json", false},
+		{"model-0000?.bin", "model-00001.bin", true},
+		{"model-0000[12].bin", "model-00002.bin", true},
+		{"model-0000[!12].bin", "model-00002.bin", false},
+		{"model-0000[!12].bin", "model-00003.bin", true},
+		{"README.md", "README.md", true},
+		{"README.md", "READMExmd", false},
+		{"[.json", "[.json", true},
+	}
+	for _, tc := range testCases {
+		re := regexp.MustCompile(fnmatchToRegexp(tc.pattern))
+		assert.Equal(t, tc.expected, re.MatchString(tc.fileName), "pattern %q, file %q", tc.pattern, tc.fileName)
+	}
+}
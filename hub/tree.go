@@ -0,0 +1,69 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/url"
+	"strings"
+)
+
+// TreeEntryType is the type of entry in the tree of a repository: TreeEntryFile or TreeEntryDirectory.
+type TreeEntryType string
+
+const (
+	TreeEntryFile      TreeEntryType = "file"
+	TreeEntryDirectory TreeEntryType = "directory"
+)
+
+// TreeEntry is a file or a directory in the tree of a repository, as returned by Repo.IterTree.
+type TreeEntry struct {
+	Type TreeEntryType `json:"type"`
+
+	// Path of the entry, relative to the root of the repository.
+	Path string `json:"path"`
+
+	// Size of the file in bytes. Always 0 for directories.
+	Size int64 `json:"size"`
+
+	// OID is the git hash of the file (or of its LFS pointer file) or of the directory.
+	OID string `json:"oid"`
+
+	// LFS information, only set for files stored with git LFS.
+	LFS *LFSInfo `json:"lfs"`
+}
+
+// IsDir returns whether the entry is a directory.
+func (e *TreeEntry) IsDir() bool {
+	return e.Type == TreeEntryDirectory
+}
+
+// treeURL for the API that lists the entries under dirPath.
+func (r *Repo) treeURL(dirPath string, recursive bool) string {
+	treeURL := fmt.Sprintf("%s/tree/%s", r.apiURL(), url.PathEscape(r.revision))
+	if dirPath = strings.Trim(dirPath, "/"); dirPath != "" {
+		treeURL += "/" + escapePath(dirPath)
+	}
+	if recursive {
+		treeURL += "?recursive=true"
+	}
+	return treeURL
+}
+
+// IterTree iterates over the files and directories under dirPath in the repository (use "" for the root directory),
+// listed directly by the HuggingFace Hub API. If recursive is true, it also iterates over the contents of the
+// subdirectories.
+//
+// Different from Repo.IterFileNames, it doesn't depend on the RepoInfo, whose list of files is truncated for very
+// large repositories: the entries are fetched one page at a time, as the iteration progresses.
+//
+// It requires access to the HuggingFace Hub: in offline mode (see Repo.WithOffline), it yields an error wrapping
+// ErrOfflineNotCached.
+func (r *Repo) IterTree(dirPath string, recursive bool) iter.Seq2[*TreeEntry, error] {
+	return r.IterTreeContext(context.Background(), dirPath, recursive)
+}
+
+// IterTreeContext is like IterTree, but the requests can be cancelled with ctx.
+func (r *Repo) IterTreeContext(ctx context.Context, dirPath string, recursive bool) iter.Seq2[*TreeEntry, error] {
+	return iterAPIPages[*TreeEntry](ctx, r, r.treeURL(dirPath, recursive))
+}
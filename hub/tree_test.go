@@ -0,0 +1,65 @@
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterTree(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/datasets/owner/data/tree/refs%2Fpr%2F1/train", r.URL.EscapedPath())
+		assert.Equal(t, "true", r.URL.Query().Get("recursive"))
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?recursive=true&cursor=page2>; rel="next"`, server.URL, r.URL.EscapedPath()))
+			_, _ = fmt.Fprint(w, `[
+				{"type": "directory", "oid": "1111111111111111111111111111111111111111", "size": 0, "path": "train/shards"},
+				{"type": "file", "oid": "2222222222222222222222222222222222222222", "size": 10, "path": "train/README.md"}
+			]`)
+		case "page2":
+			_, _ = fmt.Fprint(w, `[
+				{"type": "file", "oid": "3333333333333333333333333333333333333333", "size": 1000, "path": "train/shards/0.parquet",
+				 "lfs": {"oid": "abcd", "size": 1000, "pointerSize": 130}}
+			]`)
+		default:
+			t.Errorf("unexpected request %q", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	repo := New("owner/data").WithType(RepoTypeDataset).WithRevision("refs/pr/1").
+		WithCacheDir(t.TempDir()).WithEndpoint(server.URL)
+	var entries []*TreeEntry
+	for entry, err := range repo.IterTree("/train/", true) {
+		require.NoError(t, err)
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 3)
+	assert.True(t, entries[0].IsDir())
+	assert.Equal(t, "train/shards", entries[0].Path)
+	assert.Equal(t, TreeEntryFile, entries[1].Type)
+	assert.Nil(t, entries[1].LFS)
+	assert.Equal(t, "train/shards/0.parquet", entries[2].Path)
+	assert.Equal(t, int64(1000), entries[2].Size)
+	require.NotNil(t, entries[2].LFS)
+	assert.Equal(t, "abcd", entries[2].LFS.SHA256)
+	assert.Equal(t, int64(130), entries[2].LFS.PointerSize)
+
+	// Offline mode.
+	for _, err := range repo.WithOffline(true).IterTree("", false) {
+		require.ErrorIs(t, err, ErrOfflineNotCached)
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	assert.Equal(t, "https://hf.co/api/models?cursor=x",
+		nextPageURL(`<https://hf.co/api/models?cursor=x>; rel="next"`))
+	assert.Equal(t, "", nextPageURL(""))
+	assert.Equal(t, "", nextPageURL(`<https://hf.co/api/models?cursor=x>; rel="prev"`))
+}
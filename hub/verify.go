@@ -0,0 +1,157 @@
+package hub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gomlx/go-huggingface/internal/files"
+	"github.com/pkg/errors"
+)
+
+// CorruptedBlob describes a blob in the cache whose contents don't match its SHA-256, see Repo.VerifyCache.
+type CorruptedBlob struct {
+	// Path to the blob file in the cache.
+	Path string
+
+	// Expected SHA-256 (the name of the blob file) and the Actual SHA-256 of its contents.
+	Expected, Actual string
+
+	// SnapshotFiles are the files in the snapshots directories that link to the blob.
+	SnapshotFiles []string
+
+	// Repaired is set to true if the blob and the snapshot files linking to it were removed.
+	Repaired bool
+}
+
+// VerifyCache re-hashes the LFS blobs in the cache of the repository (the ones named after their SHA-256), and returns
+// the ones whose contents don't match.
+//
+// Other blobs, named after their git hash, are not verified.
+//
+// If repair is true, corrupted blobs and the snapshot files linking to them are removed, so the next call to
+// Repo.DownloadFiles downloads them again.
+func (r *Repo) VerifyCache(repair bool) (corrupted []*CorruptedBlob, err error) {
+	repoCacheDir := r.RepoCacheDir()
+	blobsDir := path.Join(repoCacheDir, "blobs")
+	entries, err := os.ReadDir(blobsDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to list blobs in %q", blobsDir)
+	}
+	var blobToLinks map[string][]string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isSHA256(entry.Name()) {
+			continue
+		}
+		blobPath := path.Join(blobsDir, entry.Name())
+		actual, err := fileSHA256(blobPath)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(actual, entry.Name()) {
+			continue
+		}
+
+		// Corrupted blob found.
+		if blobToLinks == nil {
+			blobToLinks, err = snapshotLinks(repoCacheDir)
+			if err != nil {
+				return nil, err
+			}
+		}
+		blob := &CorruptedBlob{
+			Path:          blobPath,
+			Expected:      entry.Name(),
+			Actual:        actual,
+			SnapshotFiles: blobToLinks[blobPath],
+		}
+		corrupted = append(corrupted, blob)
+		if repair {
+			if err = removeCorruptedBlob(r.getLogger(), blob); err != nil {
+				return corrupted, err
+			}
+			blob.Repaired = true
+		}
+	}
+	return corrupted, nil
+}
+
+// fileSHA256 returns the hex encoded SHA-256 of the contents of the file.
+func fileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open %q to compute its checksum", filePath)
+	}
+	defer func() { _ = f.Close() }()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, f); err != nil {
+		return "", errors.Wrapf(err, "failed to read %q to compute its checksum", filePath)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// snapshotLinks returns a map of the blob paths to the snapshot files (symbolic links) pointing to them.
+func snapshotLinks(repoCacheDir string) (map[string][]string, error) {
+	blobToLinks := make(map[string][]string)
+	snapshotsDir := path.Join(repoCacheDir, "snapshots")
+	if !files.Exists(snapshotsDir) {
+		return blobToLinks, nil
+	}
+	err := filepath.WalkDir(snapshotsDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(filePath), target)
+		}
+		target = filepath.Clean(target)
+		blobToLinks[target] = append(blobToLinks[target], filePath)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list snapshots in %q", snapshotsDir)
+	}
+	return blobToLinks, nil
+}
+
+// removeCorruptedBlob removes the blob and the snapshot files linking to it, while holding the blob's lock, so it
+// doesn't interfere with a concurrent download. Problems with the lock are reported to logger.
+func removeCorruptedBlob(logger *slog.Logger, blob *CorruptedBlob) error {
+	lockPath := blob.Path + ".lock"
+	var mainErr error
+	errLock := execOnFileLock(context.Background(), logger, lockPath, func() {
+		for _, link := range blob.SnapshotFiles {
+			if err := os.Remove(link); err != nil && !errors.Is(err, os.ErrNotExist) {
+				mainErr = errors.Wrapf(err, "failed to remove snapshot file %q linking to corrupted blob", link)
+				return
+			}
+		}
+		if err := os.Remove(blob.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			mainErr = errors.Wrapf(err, "failed to remove corrupted blob %q", blob.Path)
+		}
+	})
+	if mainErr != nil {
+		return mainErr
+	}
+	if errLock != nil {
+		return errors.WithMessagef(errLock, "while locking %q to remove corrupted blob", lockPath)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package hub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gomlx/go-huggingface/internal/files"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestBlob writes a blob and a snapshot file linking to it in the repo cache.
+func writeTestBlob(t *testing.T, repoCacheDir, commitHash, fileName, blobName string, content []byte) (blobPath, snapshotPath string) {
+	blobPath = path.Join(repoCacheDir, "blobs", blobName)
+	snapshotPath = path.Join(repoCacheDir, "snapshots", commitHash, fileName)
+	require.NoError(t, os.MkdirAll(path.Dir(blobPath), DefaultDirCreationPerm))
+	require.NoError(t, os.MkdirAll(path.Dir(snapshotPath), DefaultDirCreationPerm))
+	require.NoError(t, os.WriteFile(blobPath, content, DefaultFileCreationPerm))
+	require.NoError(t, createSymLink(snapshotPath, blobPath))
+	return
+}
+
+func sha256Hex(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+func TestVerifyCache(t *testing.T) {
+	repo := New("owner/model").WithCacheDir(t.TempDir())
+	repoCacheDir := repo.RepoCacheDir()
+	const commitHash = "0123456789abcdef0123456789abcdef01234567"
+
+	goodContent := []byte("good content")
+	goodBlob, goodSnapshot := writeTestBlob(t, repoCacheDir, commitHash, "good.safetensors", sha256Hex(goodContent), goodContent)
+	badBlob, badSnapshot := writeTestBlob(t, repoCacheDir, commitHash, "sub/bad.safetensors",
+		sha256Hex([]byte("expected content")), []byte("corrupted content"))
+	gitBlob, _ := writeTestBlob(t, repoCacheDir, commitHash, "config.json",
+		"d7edf6bd2a681fb0175f7735299831ee1b22b812", []byte("not verified"))
+
+	corrupted, err := repo.VerifyCache(false)
+	require.NoError(t, err)
+	require.Len(t, corrupted, 1)
+	assert.Equal(t, badBlob, corrupted[0].Path)
+	assert.Equal(t, sha256Hex([]byte("corrupted content")), corrupted[0].Actual)
+	assert.Equal(t, []string{badSnapshot}, corrupted[0].SnapshotFiles)
+	assert.False(t, corrupted[0].Repaired)
+	assert.True(t, files.Exists(badBlob))
+
+	corrupted, err = repo.VerifyCache(true)
+	require.NoError(t, err)
+	require.Len(t, corrupted, 1)
+	assert.True(t, corrupted[0].Repaired)
+	assert.False(t, files.Exists(badBlob))
+	assert.False(t, files.Exists(badSnapshot))
+	for _, p := range []string{goodBlob, goodSnapshot, gitBlob} {
+		assert.True(t, files.Exists(p), "%q should not have been removed", p)
+	}
+}
@@ -0,0 +1,168 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting the bytes per second.
+//
+// Bytes can be taken in advance (the bucket goes negative), and the caller waits until the debt is paid,
+// so reads of any size can be limited.
+type rateLimiter struct {
+	mu             sync.Mutex
+	rate, capacity float64 // In bytes/second and bytes.
+	tokens         float64
+	last           time.Time
+}
+
+// newRateLimiter returns a rateLimiter of bytesPerSecond, allowing bursts of up to one second worth of bytes.
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{
+		rate:     float64(bytesPerSecond),
+		capacity: float64(bytesPerSecond),
+		tokens:   float64(bytesPerSecond),
+		last:     time.Now(),
+	}
+}
+
+// wait takes n bytes from the bucket, and waits until they are available.
+// It returns CancellationError if ctx is cancelled while waiting.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.capacity, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return CancellationError
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WithBandwidthLimit limits the total download bandwidth of the Manager (shared by all its downloads) to
+// bytesPerSecond. Set it to 0 (the default) for no limit.
+//
+// Only the contents downloaded are limited, not the requests sent (e.g. uploads).
+//
+// It can be changed while downloading, and it applies to the requests started afterward.
+func (m *Manager) WithBandwidthLimit(bytesPerSecond int64) *Manager {
+	m.bandwidthMu.Lock()
+	defer m.bandwidthMu.Unlock()
+	m.bandwidthLimit = nil
+	if bytesPerSecond > 0 {
+		m.bandwidthLimit = newRateLimiter(bytesPerSecond)
+	}
+	return m
+}
+
+// WithHostBandwidthLimit limits the download bandwidth from the given host (e.g. "cdn-lfs.huggingface.co") to
+// bytesPerSecond, in addition to the limit set with Manager.WithBandwidthLimit. Set it to 0 to remove the limit.
+//
+// The host is matched against the URL of the final response, after following redirects.
+// Like Manager.WithBandwidthLimit, it can be changed while downloading.
+func (m *Manager) WithHostBandwidthLimit(host string, bytesPerSecond int64) *Manager {
+	m.bandwidthMu.Lock()
+	defer m.bandwidthMu.Unlock()
+	if bytesPerSecond <= 0 {
+		delete(m.hostBandwidthLimits, host)
+		return m
+	}
+	if m.hostBandwidthLimits == nil {
+		m.hostBandwidthLimits = make(map[string]*rateLimiter)
+	}
+	m.hostBandwidthLimits[host] = newRateLimiter(bytesPerSecond)
+	return m
+}
+
+// maxThrottledRead is the maximum size of each read of a body with limited bandwidth, so the transfer is smooth.
+const maxThrottledRead = 64 * 1024
+
+// throttledReader reads from a response body, limited by the Manager's bandwidth limits.
+type throttledReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	limiters []*rateLimiter
+}
+
+// Read implements io.Reader.
+func (r *throttledReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p[:min(len(p), maxThrottledRead)])
+	if n > 0 {
+		for _, limiter := range r.limiters {
+			if waitErr := limiter.wait(r.ctx, n); waitErr != nil {
+				return n, waitErr
+			}
+		}
+	}
+	return n, err
+}
+
+// throttledBody returns the body of the response (resp.Body, possibly wrapped), limited by the bandwidth limits of
+// the Manager that apply to it.
+func (m *Manager) throttledBody(ctx context.Context, resp *http.Response, body io.Reader) io.Reader {
+	m.bandwidthMu.RLock()
+	defer m.bandwidthMu.RUnlock()
+	var limiters []*rateLimiter
+	if m.bandwidthLimit != nil {
+		limiters = append(limiters, m.bandwidthLimit)
+	}
+	if resp.Request != nil {
+		if limiter, found := m.hostBandwidthLimits[resp.Request.URL.Hostname()]; found {
+			limiters = append(limiters, limiter)
+		}
+	}
+	if len(limiters) == 0 {
+		return body
+	}
+	return &throttledReader{ctx: ctx, reader: body, limiters: limiters}
+}
+
+// priorityKey is the context key for the priority of the requests, see WithPriority.
+type priorityKey struct{}
+
+// WithPriority returns a context that sets the priority of the requests made with it: while waiting for one of the
+// Manager's parallel downloads slots (see Manager.MaxParallel), requests with higher priority go first.
+// The default priority is 0, and it can be negative.
+//
+// E.g.: give small configuration files a higher priority, so they don't wait behind large files.
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// ContextPriority returns the priority set in ctx with WithPriority, or 0 if not set.
+func ContextPriority(ctx context.Context) int {
+	priority, _ := ctx.Value(priorityKey{}).(int)
+	return priority
+}
+
+// groupKey is the context key for the group of the requests, see WithGroup.
+type groupKey struct{}
+
+// WithGroup returns a context that sets the group of the requests made with it: while waiting for one of the
+// Manager's parallel downloads slots (see Manager.MaxParallel), requests with the same priority are served in
+// turns between their groups (see Semaphore.AcquireGroup).
+//
+// E.g.: use the repository as the group, so the many files of one repository don't starve the downloads of others.
+func WithGroup(ctx context.Context, group string) context.Context {
+	return context.WithValue(ctx, groupKey{}, group)
+}
+
+// acquire one of the Manager's parallel requests slots, with the priority and group set in ctx (see WithPriority
+// and WithGroup).
+func (m *Manager) acquire(ctx context.Context) error {
+	group, _ := ctx.Value(groupKey{}).(string)
+	return m.semaphore.AcquireGroup(ctx, ContextPriority(ctx), group)
+}
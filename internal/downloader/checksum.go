@@ -0,0 +1,93 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChecksumError is returned when the SHA-256 of a downloaded content doesn't match the expected one.
+type ChecksumError struct {
+	// URL from where the content was downloaded.
+	URL string
+
+	// Expected and Actual SHA-256 of the content, hex encoded.
+	Expected, Actual string
+}
+
+// Error implements the error interface.
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %q: expected sha256 %s, got %s", e.URL, e.Expected, e.Actual)
+}
+
+// streamHasher computes the SHA-256 of a file while it is being downloaded, so no second pass over the file is needed.
+//
+// A nil *streamHasher is valid, and all its methods are no-ops.
+type streamHasher struct {
+	hash hash.Hash
+
+	// size is the number of bytes of the file already hashed.
+	size int64
+}
+
+func newStreamHasher() *streamHasher {
+	return &streamHasher{hash: sha256.New()}
+}
+
+// write bytes appended to the file.
+func (h *streamHasher) write(p []byte) {
+	if h == nil {
+		return
+	}
+	_, _ = h.hash.Write(p) // hash.Hash never returns an error.
+	h.size += int64(len(p))
+}
+
+// catchUp makes sure the hash reflects the first offset bytes of filePath: if the file has been truncated it restarts
+// the hash, and if it has bytes not yet hashed (e.g. from a previous interrupted download) they are read and hashed.
+func (h *streamHasher) catchUp(filePath string, offset int64) error {
+	if h == nil || offset == h.size {
+		return nil
+	}
+	if offset < h.size {
+		h.hash.Reset()
+		h.size = 0
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %q to compute its checksum", filePath)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err = f.Seek(h.size, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "failed to read %q to compute its checksum", filePath)
+	}
+	n, err := io.CopyN(h.hash, f, offset-h.size)
+	h.size += n
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %q to compute its checksum", filePath)
+	}
+	return nil
+}
+
+// verify that the hashed content matches the expected SHA-256. If it doesn't match, filePath is removed, since
+// it can't be used, nor resumed, and a *ChecksumError is returned.
+func (h *streamHasher) verify(url, filePath, expected string) error {
+	if h == nil {
+		return nil
+	}
+	actual := hex.EncodeToString(h.hash.Sum(nil))
+	if strings.EqualFold(actual, expected) {
+		return nil
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "failed to remove %q, after its checksum didn't match (expected sha256 %s, got %s)",
+			filePath, expected, actual)
+	}
+	return &ChecksumError{URL: url, Expected: expected, Actual: actual}
+}
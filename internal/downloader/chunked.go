@@ -0,0 +1,412 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultChunkedMinSize is the default minimum size of the files downloaded in parallel chunks.
+	DefaultChunkedMinSize = 128 * 1024 * 1024
+
+	// DefaultNumChunks is the default number of chunks files of at least DefaultChunkedMinSize are split into.
+	DefaultNumChunks = 8
+
+	// ChunksStateSuffix is appended to the path of a file being downloaded in chunks, to name the file where the
+	// progress of each chunk is saved, so an interrupted download (even if the program crashes) can be resumed.
+	// See RemovePartialDownload.
+	ChunksStateSuffix = ".chunks"
+
+	// chunksStateSaveInterval is the minimum interval between saves of the progress of a chunked download.
+	chunksStateSaveInterval = time.Second
+)
+
+// WithChunkedDownloads configures the download of large files in parallel chunks: files of at least minSize bytes
+// are split into numChunks byte ranges, downloaded concurrently. Each chunk takes one of the slots of the maximum
+// number of parallel downloads (see Manager.MaxParallel), and failed chunks are retried individually.
+//
+// Chunked downloads are only used if the size of the file is known in advance (see DownloadOptions.Size), and
+// the server supports range requests -- otherwise the file is downloaded sequentially.
+//
+// Set numChunks to 1 or less to disable chunked downloads. The defaults are DefaultChunkedMinSize and DefaultNumChunks.
+func (m *Manager) WithChunkedDownloads(minSize int64, numChunks int) *Manager {
+	m.chunkedMinSize = minSize
+	m.numChunks = numChunks
+	return m
+}
+
+// errChunkedNotPossible is returned by downloadChunked if the server doesn't return the requested ranges, or if the
+// content changed. In which case the download should continue sequentially.
+var errChunkedNotPossible = errors.New("server doesn't support chunked download")
+
+// useChunked returns whether the download should be split in chunks.
+func (m *Manager) useChunked(opts DownloadOptions) bool {
+	return m.numChunks > 1 && opts.Size > 0 && opts.Size >= m.chunkedMinSize
+}
+
+// downloadChunk is the byte range [Start, End) of the file to download, of which Written bytes are already written.
+type downloadChunk struct {
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"`
+	Written int64 `json:"written"`
+}
+
+// chunksState is the progress of a chunked download, saved in the file with the ChunksStateSuffix.
+//
+// The downloaded file is preallocated to its full size, so its length doesn't tell how much was downloaded:
+// while the state file exists, only the bytes reported as written in it are known to be downloaded.
+type chunksState struct {
+	Size   int64            `json:"size"`
+	ETag   string           `json:"etag,omitempty"`
+	Chunks []*downloadChunk `json:"chunks"`
+}
+
+// contiguousPrefix returns the number of bytes downloaded contiguously from the start of the file.
+func (s *chunksState) contiguousPrefix() int64 {
+	if len(s.Chunks) == 0 {
+		return 0
+	}
+	prefix := s.Chunks[0].Start
+	for _, chunk := range s.Chunks {
+		if chunk.Start != prefix {
+			break
+		}
+		prefix = chunk.Start + chunk.Written
+		if prefix < chunk.End {
+			break
+		}
+	}
+	return prefix
+}
+
+// save the state to statePath, atomically: it is first written to a temporary file.
+func (s *chunksState) save(statePath string) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode the state of chunked download %q", statePath)
+	}
+	tmpPath := statePath + ".tmp"
+	if err = os.WriteFile(tmpPath, content, 0666); err != nil {
+		return errors.Wrapf(err, "failed to write the state of chunked download %q", statePath)
+	}
+	if err = os.Rename(tmpPath, statePath); err != nil {
+		return errors.Wrapf(err, "failed to write the state of chunked download %q", statePath)
+	}
+	return nil
+}
+
+// loadChunksState reads the state of an interrupted chunked download. It returns nil if there is none, or if it is
+// invalid.
+func loadChunksState(statePath string) *chunksState {
+	content, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil
+	}
+	state := &chunksState{}
+	if err = json.Unmarshal(content, state); err != nil || state.Size <= 0 {
+		return nil
+	}
+	for _, chunk := range state.Chunks {
+		if chunk.Start < 0 || chunk.End > state.Size || chunk.Written < 0 || chunk.Start+chunk.Written > chunk.End {
+			return nil
+		}
+	}
+	return state
+}
+
+// resumeChunked returns the state of an interrupted chunked download of file, if it is for the same content
+// (opts.Size and opts.ETag). Otherwise, if there is a state file, file is truncated to the bytes known to be
+// downloaded contiguously from the start (all of them if the state file is invalid), and the state file is removed.
+//
+// Without a state file, the size of the file is the number of bytes downloaded.
+func resumeChunked(file *os.File, statePath string, opts DownloadOptions) (*chunksState, error) {
+	if _, err := os.Stat(statePath); err != nil {
+		return nil, nil
+	}
+	state := loadChunksState(statePath)
+	if state != nil && state.Size == opts.Size && state.ETag == opts.ETag {
+		return state, nil
+	}
+	var prefix int64
+	if state != nil {
+		prefix = state.contiguousPrefix()
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find the size of the partially downloaded file %q", file.Name())
+	}
+	if info.Size() > prefix {
+		if err = file.Truncate(prefix); err != nil {
+			return nil, errors.Wrapf(err, "failed to truncate %q to the downloaded %d bytes", file.Name(), prefix)
+		}
+	}
+	if err = os.Remove(statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Wrapf(err, "failed to remove the state of chunked download %q", statePath)
+	}
+	return nil, nil
+}
+
+// discardChunked makes sure filePath can be resumed sequentially: if it holds an interrupted chunked download,
+// it is truncated to the bytes downloaded contiguously from the start.
+func discardChunked(filePath string) error {
+	statePath := filePath + ChunksStateSuffix
+	if _, err := os.Stat(statePath); err != nil {
+		return nil
+	}
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0666)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(os.Remove(statePath), "failed to remove the state of chunked download %q", statePath)
+		}
+		return errors.Wrapf(err, "failed to open partially downloaded file %q", filePath)
+	}
+	defer func() { _ = file.Close() }()
+	_, err = resumeChunked(file, statePath, DownloadOptions{})
+	return err
+}
+
+// RemovePartialDownload removes filePath, holding an interrupted download, and the state of its chunks, if it
+// was downloaded in chunks (see ChunksStateSuffix). It is not an error if they don't exist.
+func RemovePartialDownload(filePath string) error {
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "failed to remove partial download %q", filePath)
+	}
+	statePath := filePath + ChunksStateSuffix
+	if err := os.Remove(statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "failed to remove the state of chunked download %q", statePath)
+	}
+	return nil
+}
+
+// downloadChunked downloads the file in parallel chunks, each written with WriteAt to its position in the
+// preallocated file. If filePath already holds a partial download, only the missing bytes are downloaded.
+//
+// The progress of the chunks is saved periodically in filePath+ChunksStateSuffix, so that it can be resumed
+// after a crash. If the download fails, the file is truncated to the bytes downloaded contiguously from the start,
+// and the state file is removed, so it can be resumed later (also sequentially).
+//
+// If hasher is not nil, it is fed in order while the chunks are downloaded: the bytes extending the hashed prefix
+// are hashed as they are received, and the bytes of the following chunks, received earlier, are read back as soon
+// as they become contiguous to the hashed prefix.
+func (m *Manager) downloadChunked(ctx context.Context, url, filePath string, opts DownloadOptions, hasher *streamHasher) error {
+	if err := os.MkdirAll(path.Dir(filePath), 0777); err != nil {
+		return errors.Wrapf(err, "Failed to create the directory for the path: %q", path.Dir(filePath))
+	}
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "failed creating file %q", filePath)
+	}
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+	size := opts.Size
+	statePath := filePath + ChunksStateSuffix
+	state, err := resumeChunked(file, statePath, opts)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		offset, err := file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return errors.Wrapf(err, "failed to find the size of the partially downloaded file %q", filePath)
+		}
+		if offset == size {
+			// Already downloaded.
+			return nil
+		}
+		if offset > size {
+			// Invalid partial download: start from scratch.
+			offset = 0
+		}
+
+		// Split remaining bytes in chunks, and save them before preallocating the file.
+		state = &chunksState{Size: size, ETag: opts.ETag}
+		numChunks := int64(m.numChunks)
+		chunkSize := (size - offset + numChunks - 1) / numChunks
+		for start := offset; start < size; start += chunkSize {
+			state.Chunks = append(state.Chunks, &downloadChunk{Start: start, End: min(start+chunkSize, size)})
+		}
+		if err = state.save(statePath); err != nil {
+			return err
+		}
+	}
+	if err = file.Truncate(size); err != nil {
+		return errors.Wrapf(err, "failed to preallocate %d bytes for %q", size, filePath)
+	}
+	if err = hasher.catchUp(filePath, state.contiguousPrefix()); err != nil {
+		return err
+	}
+
+	// Aggregated progress, saved periodically to the state file.
+	var mu sync.Mutex
+	downloaded := size
+	for _, chunk := range state.Chunks {
+		downloaded -= chunk.End - chunk.Start - chunk.Written
+	}
+	lastSave := time.Now()
+	reportFn := func(chunk *downloadChunk, p []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		n := int64(len(p))
+		if chunk != nil {
+			if hasher != nil && chunk.Start+chunk.Written == hasher.size {
+				hasher.write(p)
+			}
+			chunk.Written += n
+			if hasher != nil {
+				if prefix := state.contiguousPrefix(); prefix > hasher.size {
+					if err := hasher.catchUp(filePath, prefix); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		downloaded += n
+		if time.Since(lastSave) >= chunksStateSaveInterval {
+			lastSave = time.Now()
+			if err := state.save(statePath); err != nil {
+				m.log().WarnContext(ctx, "failed to save progress of chunked download", "file", filePath, "error", err)
+			}
+		}
+		if opts.Callback != nil {
+			opts.Callback(downloaded, size)
+		}
+		return nil
+	}
+	_ = reportFn(nil, nil)
+
+	// Download chunks in parallel: the first error interrupts all others.
+	chunksCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	var firstErr error
+	for _, chunk := range state.Chunks {
+		if chunk.Start+chunk.Written >= chunk.End {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.withRetries(chunksCtx, url, func() error {
+				return m.downloadChunkOnce(chunksCtx, url, opts.ETag, file, chunk, reportFn)
+			})
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		if ctx.Err() != nil {
+			firstErr = CancellationError
+		}
+		// Keep only the bytes downloaded contiguously from the start.
+		prefix := state.contiguousPrefix()
+		if err = file.Truncate(prefix); err != nil {
+			return errors.Wrapf(err, "failed to truncate %q to the downloaded %d bytes, after error: %v", filePath, prefix, firstErr)
+		}
+		if err = os.Remove(statePath); err != nil {
+			return errors.Wrapf(err, "failed to remove the state of chunked download %q, after error: %v", statePath, firstErr)
+		}
+		return firstErr
+	}
+	err = file.Close()
+	file = nil
+	if err != nil {
+		return errors.Wrapf(err, "failed closing file %q", filePath)
+	}
+	if err = os.Remove(statePath); err != nil {
+		return errors.Wrapf(err, "failed to remove the state of chunked download %q", statePath)
+	}
+	return nil
+}
+
+// downloadChunkOnce implements one attempt of downloading the chunk, resuming from the bytes already written.
+//
+// The bytes written are reported with reportFn, which updates chunk.Written.
+func (m *Manager) downloadChunkOnce(ctx context.Context, url, etag string, file *os.File, chunk *downloadChunk,
+	reportFn func(chunk *downloadChunk, p []byte) error) error {
+	if err := m.acquire(ctx); err != nil {
+		return errors.WithMessagef(err, "while waiting to download %q", url)
+	}
+	defer m.semaphore.Release()
+
+	start := chunk.Start + chunk.Written
+	reqCtx, stall := withStallTimeout(ctx, m.downloadTimeout)
+	defer stall.close()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed creating request for %q", url)
+	}
+	m.setRequestHeader(req)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, chunk.End-1))
+	if etag != "" {
+		req.Header.Set("If-Range", quoteETag(etag))
+	}
+	resp, err := m.client(checkRedirect).Do(req)
+	stall.pause()
+	if err != nil {
+		return stall.wrapErr(url, errors.Wrapf(err, "failed downloading %q", url))
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		respStart, _, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		respETag := resp.Header.Get("ETag")
+		if !ok || respStart != start || (etag != "" && respETag != "" && normalizeETag(respETag) != normalizeETag(etag)) {
+			return errChunkedNotPossible
+		}
+	case http.StatusOK:
+		// Ranges not supported, or content changed.
+		return errChunkedNotPossible
+	default:
+		return newStatusError(url, resp)
+	}
+
+	const maxBufferSize = 1024 * 1024
+	buf := make([]byte, maxBufferSize)
+	body := m.throttledBody(ctx, resp, stall.reader(resp.Body))
+	for chunk.Start+chunk.Written < chunk.End {
+		toRead := min(int64(len(buf)), chunk.End-chunk.Start-chunk.Written)
+		n, err := body.Read(buf[:toRead])
+		if n > 0 {
+			if _, err := file.WriteAt(buf[:n], chunk.Start+chunk.Written); err != nil {
+				return errors.Wrapf(err, "failed writing %q to %q", url, file.Name())
+			}
+			if err := reportFn(chunk, buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return CancellationError
+			}
+			if err == io.EOF {
+				break
+			}
+			return stall.wrapErr(url, errors.Wrapf(err, "failed downloading %q", url))
+		}
+	}
+	if chunk.Start+chunk.Written < chunk.End {
+		return errors.Wrapf(io.ErrUnexpectedEOF, "failed downloading %q: connection closed after %d bytes of the range [%d, %d)",
+			url, chunk.Written, chunk.Start, chunk.End)
+	}
+	return nil
+}
@@ -9,9 +9,14 @@ import (
 	"github.com/gomlx/go-huggingface/internal/files"
 	"github.com/pkg/errors"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // ProgressCallback is called as download progresses.
@@ -22,11 +27,44 @@ type ProgressCallback func(downloadedBytes, totalBytes int64)
 type Manager struct {
 	semaphore            *Semaphore
 	authToken, userAgent string
+	retryPolicy          RetryPolicy
+	httpClient           *http.Client
+	logger               *slog.Logger
+
+	// Timeouts, see WithMetadataTimeout and WithDownloadTimeout.
+	metadataTimeout, downloadTimeout time.Duration
+
+	// Bandwidth limits, see WithBandwidthLimit and WithHostBandwidthLimit. They can be changed while downloading,
+	// so they are protected by bandwidthMu.
+	bandwidthMu         sync.RWMutex
+	bandwidthLimit      *rateLimiter
+	hostBandwidthLimits map[string]*rateLimiter
+
+	// Chunked downloads configuration, see WithChunkedDownloads.
+	chunkedMinSize int64
+	numChunks      int
+}
+
+// defaultHTTPClient is shared by all Managers without an http.Client configured, so connections are reused
+// across Managers.
+// It uses the proxy configuration from the environment (HTTPS_PROXY, NO_PROXY, etc.), like http.DefaultTransport.
+var defaultHTTPClient = &http.Client{Transport: newDefaultTransport()}
+
+// newDefaultTransport returns a clone of http.DefaultTransport (with keep-alives), that keeps more idle connections
+// per host, since most requests go to the same few hosts (the HuggingFace Hub and its CDN).
+func newDefaultTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 20
+	return transport
 }
 
 // New creates a Manager that download files in parallel -- by default mostly 20 in parallel.
+//
+// Failed requests are retried according to DefaultRetryPolicy, see Manager.WithRetryPolicy to change it.
+// Large files are downloaded in parallel chunks, see Manager.WithChunkedDownloads.
 func New() *Manager {
-	return &Manager{semaphore: NewSemaphore(20)}
+	return &Manager{semaphore: NewSemaphore(20), retryPolicy: DefaultRetryPolicy(),
+		chunkedMinSize: DefaultChunkedMinSize, numChunks: DefaultNumChunks}
 }
 
 // MaxParallel indicates how many files to download at the same time. Default is 20.
@@ -46,6 +84,44 @@ func (m *Manager) WithAuthToken(authToken string) *Manager {
 	return m
 }
 
+// WithHTTPClient sets the http.Client used for all requests, e.g. to configure a proxy, TLS certificates for an
+// internal mirror, or a transport for tests. If set to nil, a default client shared by all Managers is used.
+//
+// The client's CheckRedirect is replaced by the Manager's redirect policy (see Manager.FetchHeader), and since a
+// client Timeout includes reading the body of the response, it should be left at 0 for the download of large
+// files -- use a context with deadline instead.
+func (m *Manager) WithHTTPClient(client *http.Client) *Manager {
+	m.httpClient = client
+	return m
+}
+
+// WithLogger sets the logger used to report retries (at slog.LevelInfo) and completed downloads (at slog.LevelDebug).
+// If set to nil (the default), slog.Default() is used.
+func (m *Manager) WithLogger(logger *slog.Logger) *Manager {
+	m.logger = logger
+	return m
+}
+
+// log returns the configured logger, or slog.Default().
+func (m *Manager) log() *slog.Logger {
+	if m.logger != nil {
+		return m.logger
+	}
+	return slog.Default()
+}
+
+// client returns a shallow copy of the configured http.Client (so connections are still shared), using the given
+// CheckRedirect function.
+func (m *Manager) client(checkRedirectFn func(req *http.Request, via []*http.Request) error) *http.Client {
+	client := defaultHTTPClient
+	if m.httpClient != nil {
+		client = m.httpClient
+	}
+	clientCopy := *client
+	clientCopy.CheckRedirect = checkRedirectFn
+	return &clientCopy
+}
+
 // WithUserAgent sets the user agent to user.
 func (m *Manager) WithUserAgent(userAgent string) *Manager {
 	m.userAgent = userAgent
@@ -54,6 +130,57 @@ func (m *Manager) WithUserAgent(userAgent string) *Manager {
 
 var CancellationError = errors.New("download cancelled")
 
+// StatusError is returned when the server replies with an unexpected HTTP status code.
+type StatusError struct {
+	// URL of the failed request.
+	URL string
+
+	// StatusCode returned by the server.
+	StatusCode int
+
+	// ErrorCode returned by the server in the "X-Error-Code" header, if any. HuggingFace Hub uses it to tell
+	// the reason of the error, e.g.: "RepoNotFound", "GatedRepo", "RevisionNotFound" or "EntryNotFound".
+	ErrorCode string
+
+	// Message returned by the server in the "X-Error-Message" header, if any.
+	Message string
+
+	// RetryAfter is the delay requested by the server in the "Retry-After" header, or 0 if not given.
+	RetryAfter time.Duration
+}
+
+// newStatusError creates a StatusError from the response.
+func newStatusError(url string, resp *http.Response) *StatusError {
+	return &StatusError{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		ErrorCode:  resp.Header.Get("X-Error-Code"),
+		Message:    resp.Header.Get("X-Error-Message"),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad status code %d: %q", e.StatusCode, e.Message)
+}
+
+// maxRedirects is the maximum number of redirects followed by a request.
+const maxRedirects = 10
+
+// checkRedirect implements http.Client.CheckRedirect: it follows up to maxRedirects redirects, and it removes
+// the "Authorization" header whenever the host changes, so the authentication token is not sent to a CDN
+// or to a third-party mirror.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Host != via[0].URL.Host {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
 // setRequestHeader with configured fields.
 func (m *Manager) setRequestHeader(req *http.Request) {
 	if m.authToken != "" {
@@ -68,30 +195,118 @@ func (m *Manager) setRequestHeader(req *http.Request) {
 // This may lock if it reached the maximum number of parallel downloads.
 // Consider calling this on its own go-routine.
 //
+// If filePath already exists, it is assumed to be a partial download of the same content (e.g.: from a previous
+// interrupted download), and Download attempts to resume it, requesting only the missing bytes with an
+// HTTP "Range" header. If the server doesn't support ranges, the file is truncated and downloaded in full.
+//
 // Progress of download is reported back to the given callback, if not nil.
 //
 // The context ctx can be used to interrupt the downloading.
 func (m *Manager) Download(ctx context.Context, url string, filePath string, callback ProgressCallback) error {
-	m.semaphore.Acquire()
-	defer m.semaphore.Release()
+	return m.DownloadWithOptions(ctx, url, filePath, DownloadOptions{Callback: callback})
+}
 
-	client := &http.Client{
-		CheckRedirect: func(r *http.Request, via []*http.Request) error {
-			r.URL.Opaque = r.URL.Path
-			return nil
-		},
-	}
+// DownloadWithETag is like Download, but it also takes the etag of the content being downloaded (e.g. as returned
+// by FetchHeader), used to validate the resuming of a partial download. See DownloadOptions.ETag.
+func (m *Manager) DownloadWithETag(ctx context.Context, url, filePath, etag string, callback ProgressCallback) error {
+	return m.DownloadWithOptions(ctx, url, filePath, DownloadOptions{ETag: etag, Callback: callback})
+}
 
-	var err error
-	filePath, err = files.ReplaceTildeInDir(filePath)
+// DownloadOptions for Manager.DownloadWithOptions.
+type DownloadOptions struct {
+	// ETag of the content being downloaded (e.g. as returned by FetchHeader), used to validate the resuming of
+	// a partial download.
+	//
+	// When resuming, the etag is sent in the "If-Range" header, so the server returns the full content if it has
+	// changed, and a partial response with a different "ETag" is discarded.
+	// If ETag is empty, only the "Content-Range" returned by the server is validated.
+	ETag string
+
+	// SHA256, if not empty, is the expected SHA-256 (hex encoded) of the downloaded content.
+	// The hash is computed while downloading, and if it doesn't match, the downloaded file is removed and
+	// a *ChecksumError is returned.
+	SHA256 string
+
+	// Size of the content in bytes, if known in advance (e.g. as returned by FetchHeader).
+	// If it is at least the minimum size configured with Manager.WithChunkedDownloads, the content is downloaded
+	// in parallel chunks.
+	Size int64
+
+	// Callback reports the progress of the download, if not nil.
+	Callback ProgressCallback
+}
+
+// DownloadWithOptions is like Download, but with extra options, see DownloadOptions.
+//
+// Failed attempts are retried according to the Manager's RetryPolicy, resuming from where the previous attempt stopped.
+func (m *Manager) DownloadWithOptions(ctx context.Context, url, filePath string, opts DownloadOptions) error {
+	filePath, err := files.ReplaceTildeInDir(filePath)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to resolve user name in tilde (~) expansion: %q", filePath)
 	}
+	start := time.Now()
+	if err = m.downloadWithOptions(ctx, url, filePath, opts); err != nil {
+		return err
+	}
+	if m.log().Enabled(ctx, slog.LevelDebug) {
+		var size int64
+		if info, err := os.Stat(filePath); err == nil {
+			size = info.Size()
+		}
+		m.log().DebugContext(ctx, "downloaded file", "url", url, "file", filePath, "bytes", size,
+			"duration", time.Since(start))
+	}
+	return nil
+}
+
+// downloadWithOptions implements DownloadWithOptions.
+func (m *Manager) downloadWithOptions(ctx context.Context, url, filePath string, opts DownloadOptions) error {
+	var hasher *streamHasher
+	if opts.SHA256 != "" {
+		hasher = newStreamHasher()
+	}
+	if m.useChunked(opts) {
+		err := m.downloadChunked(ctx, url, filePath, opts, hasher)
+		if err == nil {
+			// Only reads the file if it was already downloaded, otherwise the hasher is already caught up.
+			if err = hasher.catchUp(filePath, opts.Size); err != nil {
+				return err
+			}
+			return hasher.verify(url, filePath, opts.SHA256)
+		}
+		if err != errChunkedNotPossible {
+			return err
+		}
+		// Continue sequentially from what was downloaded.
+		m.log().DebugContext(ctx, "chunked download not supported, downloading sequentially", "url", url)
+	} else if err := discardChunked(filePath); err != nil {
+		return err
+	}
+	err := m.withRetries(ctx, url, func() error {
+		return m.downloadOnce(ctx, url, filePath, opts.ETag, hasher, opts.Callback)
+	})
+	if err != nil || hasher == nil {
+		return err
+	}
+	return hasher.verify(url, filePath, opts.SHA256)
+}
+
+// downloadOnce implements one attempt of DownloadWithOptions.
+// If hasher is not nil, it is fed with the contents of the downloaded file.
+func (m *Manager) downloadOnce(ctx context.Context, url, filePath, etag string, hasher *streamHasher, callback ProgressCallback) error {
+	if err := m.acquire(ctx); err != nil {
+		return errors.WithMessagef(err, "while waiting to download %q", url)
+	}
+	defer m.semaphore.Release()
+
+	client := m.client(checkRedirect)
+
+	var err error
 	if err = os.MkdirAll(path.Dir(filePath), 0777); err != nil {
 		return errors.Wrapf(err, "Failed to create the directory for the path: %q", path.Dir(filePath))
 	}
 	var file *os.File
-	file, err = os.Create(filePath)
+	file, err = os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0666)
 	if err != nil {
 		return errors.Wrapf(err, "failed creating file %q", filePath)
 	}
@@ -100,83 +315,263 @@ func (m *Manager) Download(ctx context.Context, url string, filePath string, cal
 			_ = file.Close()
 		}
 	}()
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	offset, err := file.Seek(0, io.SeekEnd)
 	if err != nil {
-		return errors.Wrapf(err, "failed creating request for %q", url)
+		return errors.Wrapf(err, "failed to find the size of the partially downloaded file %q", filePath)
 	}
-	m.setRequestHeader(req)
+
 	var resp *http.Response
-	resp, err = client.Do(req)
-	if err != nil {
-		return errors.Wrapf(err, "failed downloading %q", url)
+	var contentLength int64
+	reqCtx, stall := withStallTimeout(ctx, m.downloadTimeout)
+	defer stall.close()
+	for {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+		if err != nil {
+			return errors.Wrapf(err, "failed creating request for %q", url)
+		}
+		m.setRequestHeader(req)
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			if etag != "" {
+				req.Header.Set("If-Range", quoteETag(etag))
+			}
+		}
+		stall.resume()
+		resp, err = client.Do(req)
+		stall.pause()
+		if err != nil {
+			return stall.wrapErr(url, errors.Wrapf(err, "failed downloading %q", url))
+		}
+
+		var restart bool
+		switch resp.StatusCode {
+		case http.StatusOK:
+			// Full content: either we didn't ask for a range, or the server ignored it.
+			contentLength = resp.ContentLength
+			if offset > 0 {
+				if err = truncateFile(file); err != nil {
+					_ = resp.Body.Close()
+					return errors.Wrapf(err, "failed to truncate partially downloaded file %q", filePath)
+				}
+				offset = 0
+			}
+		case http.StatusPartialContent:
+			start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+			respETag := resp.Header.Get("ETag")
+			restart = !ok || start != offset ||
+				(etag != "" && respETag != "" && normalizeETag(respETag) != normalizeETag(etag))
+			if total >= 0 {
+				contentLength = total
+			} else if resp.ContentLength >= 0 {
+				contentLength = offset + resp.ContentLength
+			} else {
+				contentLength = -1
+			}
+		case http.StatusRequestedRangeNotSatisfiable:
+			_, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+			_ = resp.Body.Close()
+			if offset > 0 && ok && total == offset {
+				// Partial download was already complete.
+				if err = hasher.catchUp(filePath, offset); err != nil {
+					return err
+				}
+				if callback != nil {
+					callback(offset, total)
+				}
+				err = file.Close()
+				file = nil
+				if err != nil {
+					return errors.Wrapf(err, "failed closing file %q", filePath)
+				}
+				return nil
+			}
+			if offset == 0 {
+				return newStatusError(url, resp)
+			}
+			restart = true
+		default:
+			_ = resp.Body.Close()
+			return newStatusError(url, resp)
+		}
+		if !restart {
+			break
+		}
+
+		// The partial response can't be used: discard partially downloaded file and start from scratch.
+		_ = resp.Body.Close()
+		if offset == 0 {
+			return errors.Errorf("invalid partial content response (Content-Range=%q) for %q",
+				resp.Header.Get("Content-Range"), url)
+		}
+		if err = truncateFile(file); err != nil {
+			return errors.Wrapf(err, "failed to truncate partially downloaded file %q", filePath)
+		}
+		offset = 0
 	}
-	// _ = resp.Header.Write(os.Stdout)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status code %d: %q", resp.StatusCode, resp.Header.Get("X-Error-Message"))
+	defer func() { _ = resp.Body.Close() }()
+	if err = hasher.catchUp(filePath, offset); err != nil {
+		return err
 	}
 
-	contentLength := resp.ContentLength
 	if callback != nil {
-		callback(0, contentLength)
+		callback(offset, contentLength)
 	}
 	const maxBufferSize = 1 * 1024 * 1024
 	var buf [maxBufferSize]byte
-	downloadedBytes := int64(0)
+	body := m.throttledBody(ctx, resp, stall.reader(resp.Body))
+	downloadedBytes := offset
 	for {
 		if ctx.Err() != nil {
 			return CancellationError
 		}
-		n, err := resp.Body.Read(buf[:])
+		n, err := body.Read(buf[:])
 		if err != nil && err != io.EOF {
 			if ctx.Err() != nil {
 				return CancellationError
 			}
-			return errors.Wrapf(err, "failed downloading %q", url)
+			return stall.wrapErr(url, errors.Wrapf(err, "failed downloading %q", url))
+		}
+		if n > 0 {
+			wn, err := file.Write(buf[:n])
+			if err != nil {
+				return errors.Wrapf(err, "failed writing %q to %q", url, filePath)
+			}
+			if wn != n {
+				return errors.Wrapf(io.ErrShortWrite, "failed writing %q to %q: not enough bytes written (wanted %d, wrote only %d)",
+					url, filePath, n, wn)
+			}
+			hasher.write(buf[:n])
+			downloadedBytes += int64(n)
+			if callback != nil {
+				callback(downloadedBytes, contentLength)
+			}
 		}
 		if err == io.EOF {
 			break
 		}
-		wn, err := file.Write(buf[:n])
-		if err != nil && err != io.EOF {
-			return errors.Wrapf(err, "failed writing %q to %q", url, filePath)
-		}
-		if wn != n {
-			return errors.Wrapf(io.ErrShortWrite, "failed writing %q to %q: not enough bytes written (wanted %d, wrote only %d)",
-				url, filePath, n, wn)
-		}
-		downloadedBytes += int64(n)
-		if callback != nil {
-			callback(downloadedBytes, contentLength)
-		}
+	}
+	if contentLength >= 0 && downloadedBytes != contentLength {
+		return errors.Wrapf(io.ErrUnexpectedEOF, "failed downloading %q: connection closed after %d bytes, expected %d bytes",
+			url, downloadedBytes, contentLength)
 	}
 	err = file.Close()
 	file = nil
 	if err != nil {
 		return errors.Wrapf(err, "failed closing file %q", filePath)
 	}
-	if err = resp.Body.Close(); err != nil {
-		return errors.Wrapf(err, "failed closing connection to %q", url)
-	}
 	return nil
 }
 
+// truncateFile to zero bytes, and position the file at its start.
+func truncateFile(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.Seek(0, io.SeekStart)
+	return err
+}
+
+// parseContentRange parses the value of a "Content-Range" header, in the forms "bytes <start>-<end>/<total>"
+// or "bytes */<total>". If not given (or given as "*"), start and total are returned as -1.
+func parseContentRange(contentRange string) (start, total int64, ok bool) {
+	start, total = -1, -1
+	spec, found := strings.CutPrefix(strings.TrimSpace(contentRange), "bytes ")
+	if !found {
+		return
+	}
+	rangeSpec, totalSpec, found := strings.Cut(spec, "/")
+	if !found {
+		return
+	}
+	var err error
+	if totalSpec != "*" {
+		total, err = strconv.ParseInt(totalSpec, 10, 64)
+		if err != nil {
+			return -1, -1, false
+		}
+	}
+	if rangeSpec != "*" {
+		startSpec, _, found := strings.Cut(rangeSpec, "-")
+		if !found {
+			return -1, -1, false
+		}
+		start, err = strconv.ParseInt(startSpec, 10, 64)
+		if err != nil {
+			return -1, -1, false
+		}
+	}
+	ok = true
+	return
+}
+
+// normalizeETag removes the weak validator prefix ("W/") and quotes of an etag.
+func normalizeETag(etag string) string {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	return strings.Trim(etag, "\"")
+}
+
+// quoteETag returns the etag quoted, as required by HTTP headers, if it is not yet.
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, "\"") || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return "\"" + etag + "\""
+}
+
+// HeaderInfo is returned by Manager.FetchHeader.
+type HeaderInfo struct {
+	// Header of the first response, before following any redirects.
+	// HuggingFace Hub returns the metadata of the files (e.g.: "X-Linked-Etag", "X-Repo-Commit") in it,
+	// even if the contents are served by a CDN.
+	Header http.Header
+
+	// FinalURL is the URL after following all redirects. It is the same as the requested URL if there were no redirects.
+	FinalURL string
+
+	// FinalHeader is the header of the last response, after following all redirects.
+	FinalHeader http.Header
+
+	// ContentLength of the content served by the final URL, or -1 if not known.
+	ContentLength int64
+}
+
 // FetchHeader fetches the header of a URL (using HTTP method "HEAD").
 //
+// Redirects are followed (see HeaderInfo.FinalURL), but the "Authorization" header is not sent to a different host.
+//
 // Notice it may lock on the maximum number of parallel requests, so consider calling this on a separate goroutine.
 //
 // The context ctx can be used to interrupt the downloading.
-func (m *Manager) FetchHeader(ctx context.Context, url string) (header http.Header, contentLength int64, err error) {
-	m.semaphore.Acquire()
-	defer m.semaphore.Release()
+//
+// Failed attempts are retried according to the Manager's RetryPolicy.
+func (m *Manager) FetchHeader(ctx context.Context, url string) (info *HeaderInfo, err error) {
+	err = m.withRetries(ctx, url, func() error {
+		var attemptErr error
+		info, attemptErr = m.fetchHeaderOnce(ctx, url)
+		return attemptErr
+	})
+	return
+}
 
-	client := &http.Client{
-		CheckRedirect: func(r *http.Request, via []*http.Request) error {
-			r.URL.Opaque = r.URL.Path
-			return nil
-		},
+// fetchHeaderOnce implements one attempt of FetchHeader.
+func (m *Manager) fetchHeaderOnce(ctx context.Context, url string) (info *HeaderInfo, err error) {
+	if err = m.acquire(ctx); err != nil {
+		err = errors.WithMessagef(err, "while waiting to request metadata from %q", url)
+		return
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	defer m.semaphore.Release()
+
+	var firstHeader http.Header
+	client := m.client(func(req *http.Request, via []*http.Request) error {
+		if len(via) == 1 && req.Response != nil {
+			firstHeader = req.Response.Header
+		}
+		return checkRedirect(req, via)
+	})
+	reqCtx, stall := withStallTimeout(ctx, m.metadataTimeout)
+	defer stall.close()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodHead, url, nil)
 	if err != nil {
 		err = errors.Wrapf(err, "failed creating request for %q", url)
 		return
@@ -184,29 +579,33 @@ func (m *Manager) FetchHeader(ctx context.Context, url string) (header http.Head
 	m.setRequestHeader(req)
 	req.Header.Set("Accept-Encoding", "identity")
 
-	// Make the request and download the tokenizer.
+	// Make the request, following redirects.
 	resp, err := client.Do(req)
 	if err != nil {
-		err = errors.Wrap(err, "failed request for metadata: ")
+		err = stall.wrapErr(url, errors.Wrap(err, "failed request for metadata: "))
 		return
 	}
-
-	// TODO: handle redirects.
 	defer func() { _ = resp.Body.Close() }()
 	_, err = io.ReadAll(resp.Body)
+	stall.pause()
 	if err != nil {
-		err = errors.Wrapf(err, "failed reading response (%d) for metadata: ", resp.StatusCode)
+		err = stall.wrapErr(url, errors.Wrapf(err, "failed reading response (%d) for metadata: ", resp.StatusCode))
 		return
 	}
 
 	// Check status code.
 	if resp.StatusCode != 200 {
-		err = errors.Errorf("request for metadata from %q failed with the following message: %q",
-			url, resp.Status)
+		err = errors.WithMessagef(newStatusError(url, resp), "request for metadata from %q failed", url)
 		return
 	}
-	header = resp.Header
-	contentLength = resp.ContentLength
-	err = nil
+	if firstHeader == nil {
+		firstHeader = resp.Header
+	}
+	info = &HeaderInfo{
+		Header:        firstHeader,
+		FinalURL:      resp.Request.URL.String(),
+		FinalHeader:   resp.Header,
+		ContentLength: resp.ContentLength,
+	}
 	return
 }
@@ -0,0 +1,623 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testContent returns some deterministic content to be served.
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for ii := range content {
+		content[ii] = byte(ii % 251)
+	}
+	return content
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := testContent(100_000)
+	const etag = `"abc123"`
+	var lastRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRange = r.Header.Get("Range")
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	filePath := path.Join(t.TempDir(), "blob.downloading")
+	require.NoError(t, os.WriteFile(filePath, content[:30_000], 0644))
+	m := New()
+	var lastDownloaded, lastTotal int64
+	err := m.DownloadWithETag(context.Background(), server.URL, filePath, "abc123", func(downloaded, total int64) {
+		lastDownloaded, lastTotal = downloaded, total
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "bytes=30000-", lastRange)
+	assert.Equal(t, int64(len(content)), lastDownloaded)
+	assert.Equal(t, int64(len(content)), lastTotal)
+	got, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// Already complete file: server replies with 416, and the file is left as is.
+	require.NoError(t, m.DownloadWithETag(context.Background(), server.URL, filePath, "abc123", nil))
+	got, err = os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// Changed content (different etag): If-Range doesn't match, and the full content is downloaded.
+	require.NoError(t, os.WriteFile(filePath, []byte("stale partial content"), 0644))
+	require.NoError(t, m.DownloadWithETag(context.Background(), server.URL, filePath, "other", nil))
+	got, err = os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+func TestDownloadRangeNotSupported(t *testing.T) {
+	content := testContent(10_000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ignores the "Range" header, always returns the full content.
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	filePath := path.Join(t.TempDir(), "blob.downloading")
+	require.NoError(t, os.WriteFile(filePath, content[:5_000], 0644))
+	require.NoError(t, New().Download(context.Background(), server.URL, filePath, nil))
+	got, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+func TestParseContentRange(t *testing.T) {
+	testCases := []struct {
+		input        string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 10-99/100", 10, 100, true},
+		{"bytes 10-99/*", 10, -1, true},
+		{"bytes */100", -1, 100, true},
+		{"bytes 10/100", -1, -1, false},
+		{"items 0-9/10", -1, -1, false},
+		{"", -1, -1, false},
+	}
+	for _, tc := range testCases {
+		start, total, ok := parseContentRange(tc.input)
+		assert.Equal(t, tc.start, start, "start for %q", tc.input)
+		assert.Equal(t, tc.total, total, "total for %q", tc.input)
+		assert.Equal(t, tc.ok, ok, "ok for %q", tc.input)
+	}
+}
+
+// fastRetries is a RetryPolicy for tests, with very short backoff.
+var fastRetries = RetryPolicy{
+	MaxAttempts:          4,
+	BaseBackoff:          time.Millisecond,
+	MaxBackoff:           10 * time.Millisecond,
+	RetryableStatusCodes: []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+}
+
+func TestDownloadRetries(t *testing.T) {
+	content := testContent(100_000)
+	var numRequests int
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numRequests++
+		ranges = append(ranges, r.Header.Get("Range"))
+		switch numRequests {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			// Send only part of the content, and break the connection.
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:40_000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		default:
+			http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer server.Close()
+
+	filePath := path.Join(t.TempDir(), "blob.downloading")
+	m := New().WithRetryPolicy(fastRetries)
+	require.NoError(t, m.Download(context.Background(), server.URL, filePath, nil))
+	assert.Equal(t, 3, numRequests)
+	assert.Equal(t, []string{"", "", "bytes=40000-"}, ranges)
+	got, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// Non-retryable status codes fail immediately.
+	numRequests = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numRequests++
+		w.WriteHeader(http.StatusNotFound)
+	})
+	_, err = m.FetchHeader(context.Background(), server.URL)
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	assert.Equal(t, 1, numRequests)
+
+	// Retry-After longer than the maximum: it fails immediately.
+	numRequests = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numRequests++
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	start := time.Now()
+	_, err = m.FetchHeader(context.Background(), server.URL)
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, 24*time.Hour, statusErr.RetryAfter)
+	assert.Equal(t, 1, numRequests)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestSendRetries(t *testing.T) {
+	var numRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numRequests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	m := New().WithRetryPolicy(fastRetries)
+
+	// Idempotent methods are retried.
+	_, _, err := m.Send(context.Background(), &Request{Method: http.MethodPut, URL: server.URL, Body: strings.NewReader("x")})
+	require.Error(t, err)
+	assert.Equal(t, fastRetries.MaxAttempts, numRequests)
+
+	// POST is only sent once, unless it is marked as Retryable.
+	numRequests = 0
+	_, _, err = m.Send(context.Background(), &Request{Method: http.MethodPost, URL: server.URL, Body: strings.NewReader("x")})
+	require.Error(t, err)
+	assert.Equal(t, 1, numRequests)
+	numRequests = 0
+	_, _, err = m.Send(context.Background(), &Request{Method: http.MethodDelete, URL: server.URL})
+	require.Error(t, err)
+	assert.Equal(t, 1, numRequests)
+	numRequests = 0
+	_, _, err = m.Send(context.Background(), &Request{Method: http.MethodPost, URL: server.URL, Retryable: true})
+	require.Error(t, err)
+	assert.Equal(t, fastRetries.MaxAttempts, numRequests)
+}
+
+func TestDownloadTimeout(t *testing.T) {
+	content := testContent(100_000)
+	var mu sync.Mutex
+	var numRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		numRequests++
+		attempt := numRequests
+		mu.Unlock()
+		switch attempt {
+		case 1:
+			// Stall before responding.
+			time.Sleep(500 * time.Millisecond)
+		case 2:
+			// Stall after sending part of the content.
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:40_000])
+			w.(http.Flusher).Flush()
+			time.Sleep(500 * time.Millisecond)
+			return
+		}
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	filePath := path.Join(t.TempDir(), "blob.downloading")
+	m := New().WithRetryPolicy(fastRetries).WithDownloadTimeout(100 * time.Millisecond)
+	require.NoError(t, m.Download(context.Background(), server.URL, filePath, nil))
+	mu.Lock()
+	assert.Equal(t, 3, numRequests)
+	mu.Unlock()
+	got, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// Metadata requests time out with a timeout error, after all attempts.
+	stalledServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer stalledServer.Close()
+	m = New().WithRetryPolicy(RetryPolicy{MaxAttempts: 2}).WithMetadataTimeout(50 * time.Millisecond)
+	_, err = m.FetchHeader(context.Background(), stalledServer.URL)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestRedirects(t *testing.T) {
+	content := testContent(1_000)
+	var cdnAuth []string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnAuth = append(cdnAuth, r.Header.Get("Authorization"))
+		w.Header().Set("ETag", `"cdn-etag"`)
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(content))
+	}))
+	defer cdn.Close()
+	var hubAuth []string
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hubAuth = append(hubAuth, r.Header.Get("Authorization"))
+		w.Header().Set("X-Linked-Etag", `"sha256-etag"`)
+		w.Header().Set("X-Linked-Size", "1000")
+		http.Redirect(w, r, cdn.URL+"/blob?signature=xyz", http.StatusFound)
+	}))
+	defer hub.Close()
+
+	m := New().WithAuthToken("secret")
+	info, err := m.FetchHeader(context.Background(), hub.URL+"/resolve/main/file")
+	require.NoError(t, err)
+	assert.Equal(t, `"sha256-etag"`, info.Header.Get("X-Linked-Etag"))
+	assert.Equal(t, "1000", info.Header.Get("X-Linked-Size"))
+	assert.Equal(t, `"cdn-etag"`, info.FinalHeader.Get("ETag"))
+	assert.Equal(t, cdn.URL+"/blob?signature=xyz", info.FinalURL)
+	assert.Equal(t, int64(len(content)), info.ContentLength)
+
+	filePath := path.Join(t.TempDir(), "blob")
+	require.NoError(t, m.Download(context.Background(), hub.URL+"/resolve/main/file", filePath, nil))
+	got, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// Authorization is sent to the hub, but not to the CDN, in a different host.
+	assert.Equal(t, []string{"Bearer secret", "Bearer secret"}, hubAuth)
+	assert.Equal(t, []string{"", ""}, cdnAuth)
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	content := testContent(50_000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	hash := sha256.Sum256(content)
+	sha := hex.EncodeToString(hash[:])
+	m := New()
+
+	// Resumed download: the partial content is also hashed.
+	filePath := path.Join(t.TempDir(), "blob.downloading")
+	require.NoError(t, os.WriteFile(filePath, content[:20_000], 0644))
+	require.NoError(t, m.DownloadWithOptions(context.Background(), server.URL, filePath, DownloadOptions{SHA256: sha}))
+	got, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// Corrupted partial content: the file is removed.
+	require.NoError(t, os.WriteFile(filePath, []byte("corrupted"), 0644))
+	err = m.DownloadWithOptions(context.Background(), server.URL, filePath, DownloadOptions{SHA256: sha})
+	var checksumErr *ChecksumError
+	require.ErrorAs(t, err, &checksumErr)
+	assert.Equal(t, sha, checksumErr.Expected)
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadChunked(t *testing.T) {
+	content := testContent(100_000)
+	hash := sha256.Sum256(content)
+	sha := hex.EncodeToString(hash[:])
+	var mu sync.Mutex
+	var ranges []string
+	rangesSupported := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		supported := rangesSupported
+		mu.Unlock()
+		if !supported {
+			_, _ = w.Write(content)
+			return
+		}
+		w.Header().Set("ETag", `"abc123"`)
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	m := New().WithChunkedDownloads(10_000, 4)
+
+	// Partial download: only the remaining 80_000 bytes are split in chunks.
+	filePath := path.Join(t.TempDir(), "blob.downloading")
+	require.NoError(t, os.WriteFile(filePath, content[:20_000], 0644))
+	var lastDownloaded, lastTotal int64
+	opts := DownloadOptions{ETag: "abc123", SHA256: sha, Size: int64(len(content)),
+		Callback: func(downloaded, total int64) {
+			lastDownloaded, lastTotal = downloaded, total
+		}}
+	require.NoError(t, m.DownloadWithOptions(context.Background(), server.URL, filePath, opts))
+	got, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.Equal(t, int64(len(content)), lastDownloaded)
+	assert.Equal(t, int64(len(content)), lastTotal)
+	slices.Sort(ranges)
+	assert.Equal(t, []string{"bytes=20000-39999", "bytes=40000-59999", "bytes=60000-79999", "bytes=80000-99999"}, ranges)
+
+	// The hash is computed while the chunks are downloaded: no pass over the file is left for the end.
+	filePath = path.Join(t.TempDir(), "blob.downloading")
+	hasher := newStreamHasher()
+	require.NoError(t, m.downloadChunked(context.Background(), server.URL, filePath, opts, hasher))
+	assert.Equal(t, int64(len(content)), hasher.size)
+	assert.Equal(t, sha, hex.EncodeToString(hasher.hash.Sum(nil)))
+
+	// Wrong checksum: the file is removed.
+	filePath = path.Join(t.TempDir(), "blob.downloading")
+	wrongOpts := opts
+	wrongOpts.SHA256 = strings.Repeat("0", 64)
+	var checksumErr *ChecksumError
+	require.ErrorAs(t, m.DownloadWithOptions(context.Background(), server.URL, filePath, wrongOpts), &checksumErr)
+	assert.Equal(t, sha, checksumErr.Actual)
+	assert.NoFileExists(t, filePath)
+
+	// Smaller than the minimum size: downloaded sequentially.
+	ranges = nil
+	filePath = path.Join(t.TempDir(), "blob.downloading")
+	opts.Callback = nil
+	m.WithChunkedDownloads(200_000, 4)
+	require.NoError(t, m.DownloadWithOptions(context.Background(), server.URL, filePath, opts))
+	assert.Equal(t, []string{""}, ranges)
+
+	// Ranges not supported: falls back to a sequential download.
+	ranges = nil
+	rangesSupported = false
+	filePath = path.Join(t.TempDir(), "blob.downloading")
+	m.WithChunkedDownloads(10_000, 4)
+	require.NoError(t, m.DownloadWithOptions(context.Background(), server.URL, filePath, opts))
+	got, err = os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+func TestDownloadChunkedCrashed(t *testing.T) {
+	content := testContent(100_000)
+	hash := sha256.Sum256(content)
+	opts := DownloadOptions{ETag: "abc123", SHA256: hex.EncodeToString(hash[:]), Size: int64(len(content))}
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		w.Header().Set("ETag", `"abc123"`)
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	m := New().WithChunkedDownloads(10_000, 4)
+
+	// crashedDownload creates the preallocated file and the saved state left by a program that crashed while
+	// downloading the first chunk completely, and 5_000 bytes of the second and third chunks.
+	crashedDownload := func() string {
+		filePath := path.Join(t.TempDir(), "blob.downloading")
+		partial := make([]byte, len(content))
+		copy(partial[:30_000], content[:30_000])
+		copy(partial[50_000:55_000], content[50_000:55_000])
+		require.NoError(t, os.WriteFile(filePath, partial, 0644))
+		state := &chunksState{Size: opts.Size, ETag: opts.ETag, Chunks: []*downloadChunk{
+			{Start: 0, End: 25_000, Written: 25_000},
+			{Start: 25_000, End: 50_000, Written: 5_000},
+			{Start: 50_000, End: 75_000, Written: 5_000},
+			{Start: 75_000, End: 100_000},
+		}}
+		require.NoError(t, state.save(filePath+ChunksStateSuffix))
+		return filePath
+	}
+
+	// Chunked download resumes each chunk from where it stopped.
+	filePath := crashedDownload()
+	require.NoError(t, m.DownloadWithOptions(context.Background(), server.URL, filePath, opts))
+	got, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.NoFileExists(t, filePath+ChunksStateSuffix)
+	slices.Sort(ranges)
+	assert.Equal(t, []string{"bytes=30000-49999", "bytes=55000-74999", "bytes=75000-99999"}, ranges)
+
+	// Sequential download resumes from the bytes downloaded contiguously from the start.
+	ranges = nil
+	filePath = crashedDownload()
+	sequentialOpts := opts
+	sequentialOpts.Size = 0
+	require.NoError(t, m.DownloadWithOptions(context.Background(), server.URL, filePath, sequentialOpts))
+	got, err = os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.NoFileExists(t, filePath+ChunksStateSuffix)
+	assert.Equal(t, []string{"bytes=30000-"}, ranges)
+
+	// The state of a different content is discarded, and only the contiguous prefix is kept.
+	ranges = nil
+	filePath = crashedDownload()
+	otherOpts := opts
+	otherOpts.ETag = "other"
+	otherOpts.SHA256 = ""
+	require.NoError(t, m.DownloadWithOptions(context.Background(), server.URL, filePath, otherOpts))
+	assert.Contains(t, ranges, "bytes=30000-47499")
+	assert.NoFileExists(t, filePath+ChunksStateSuffix)
+}
+
+func TestSemaphoreAcquireContext(t *testing.T) {
+	s := NewSemaphore(1)
+	require.NoError(t, s.AcquireContext(context.Background()))
+
+	// Semaphore is full: waiting is interrupted by the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.AcquireContext(ctx), context.DeadlineExceeded)
+
+	// After release, it can be acquired again.
+	done := make(chan error)
+	go func() { done <- s.AcquireContext(context.Background()) }()
+	s.Release()
+	require.NoError(t, <-done)
+	s.Release()
+}
+
+func TestSemaphorePriority(t *testing.T) {
+	s := NewSemaphore(1)
+	s.Acquire()
+
+	// Queue waiters with different priorities, one at a time, so the arrival order is known.
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	waiters := []struct {
+		name     string
+		priority int
+	}{{"low-1", 0}, {"low-2", 0}, {"high", 10}, {"lowest", -1}}
+	for ii, waiter := range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !assert.NoError(t, s.AcquirePriority(context.Background(), waiter.priority)) {
+				return
+			}
+			mu.Lock()
+			order = append(order, waiter.name)
+			mu.Unlock()
+			s.Release()
+		}()
+		require.Eventually(t, func() bool {
+			s.cond.L.Lock()
+			defer s.cond.L.Unlock()
+			return len(s.waiting) == ii+1
+		}, time.Second, time.Millisecond)
+	}
+	s.Release()
+	wg.Wait()
+	assert.Equal(t, []string{"high", "low-1", "low-2", "lowest"}, order)
+}
+
+func TestSemaphoreGroups(t *testing.T) {
+	s := NewSemaphore(1)
+	s.Acquire()
+
+	// Queue waiters of 2 groups with the same priority, one at a time, so the arrival order is known: the groups
+	// are served in turns.
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	waiters := []struct {
+		name, group string
+		priority    int
+	}{{"a-1", "a", 0}, {"a-2", "a", 0}, {"a-3", "a", 0}, {"b-1", "b", 0}, {"b-2", "b", 0}, {"c-1", "c", 1}}
+	for ii, waiter := range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !assert.NoError(t, s.AcquireGroup(context.Background(), waiter.priority, waiter.group)) {
+				return
+			}
+			mu.Lock()
+			order = append(order, waiter.name)
+			mu.Unlock()
+			s.Release()
+		}()
+		require.Eventually(t, func() bool {
+			s.cond.L.Lock()
+			defer s.cond.L.Unlock()
+			return len(s.waiting) == ii+1
+		}, time.Second, time.Millisecond)
+	}
+	s.Release()
+	wg.Wait()
+	assert.Equal(t, []string{"c-1", "a-1", "b-1", "a-2", "b-2", "a-3"}, order)
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	content := testContent(60_000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "blob", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	// The first 20_000 bytes are the initial burst, the remaining 40_000 take ~2 seconds at 20_000 bytes/s.
+	// The host limit is higher, and doesn't change it.
+	m := New().WithBandwidthLimit(20_000).WithHostBandwidthLimit("127.0.0.1", 1_000_000)
+	filePath := path.Join(t.TempDir(), "blob.downloading")
+	start := time.Now()
+	require.NoError(t, m.Download(context.Background(), server.URL, filePath, nil))
+	elapsed := time.Since(start)
+	assert.Greater(t, elapsed, 1500*time.Millisecond)
+	assert.Less(t, elapsed, 5*time.Second)
+	got, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// Cancelled while waiting for bandwidth.
+	m = New().WithHostBandwidthLimit("127.0.0.1", 10_000)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = m.Download(ctx, server.URL, path.Join(t.TempDir(), "blob.downloading"), nil)
+	require.ErrorIs(t, err, CancellationError)
+
+	// Limits changed while downloading (checked with the race detector).
+	m = New()
+	var wg sync.WaitGroup
+	for ii := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, m.Download(context.Background(), server.URL, path.Join(t.TempDir(), strconv.Itoa(ii)), nil))
+		}()
+	}
+	for ii := range 100 {
+		m.WithBandwidthLimit(int64(10_000_000+ii)).WithHostBandwidthLimit("127.0.0.1", int64(10_000_000+ii))
+	}
+	wg.Wait()
+}
+
+// roundTripperFunc implements http.RoundTripper with a function.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	// Transport that counts the requests, and forwards them to the test server.
+	var numRequests int
+	client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		numRequests++
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	m := New().WithHTTPClient(client)
+	content, _, err := m.Fetch(context.Background(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+	filePath := path.Join(t.TempDir(), "file")
+	require.NoError(t, m.Download(context.Background(), server.URL, filePath, nil))
+	assert.Equal(t, 2, numRequests)
+	assert.Nil(t, client.CheckRedirect, "client given by the user shouldn't be modified")
+}
@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Request is a generic HTTP request to be sent with Manager.Send, e.g. to the HuggingFace Hub API.
+type Request struct {
+	// Method of the request, e.g. http.MethodPost. Defaults to http.MethodGet if empty.
+	Method string
+
+	URL string
+
+	// Header fields to set in the request, in addition to the authentication and user agent ones.
+	Header http.Header
+
+	// Body of the request, or nil if there is none. Since the request may be retried, it must be seekable:
+	// it's rewound to the start before each attempt.
+	Body io.ReadSeeker
+
+	// NoAuth disables sending the authentication token, e.g.: for pre-signed URLs of external storage services.
+	NoAuth bool
+
+	// Retryable marks the request as safe to be sent more than once, so it is retried on failures even if its method
+	// is not idempotent (e.g. a POST that only queries information).
+	//
+	// Requests with the methods GET, HEAD, OPTIONS and PUT are always retried. Others, like a POST that creates
+	// a commit, are not retried by default: if a failure happens after the server applied the request (e.g. the
+	// connection is reset before the response is read), a retry would apply it again.
+	Retryable bool
+}
+
+// isRetryable returns whether the request can be retried: if its method is idempotent, or it is marked as Retryable.
+func (req *Request) isRetryable() bool {
+	switch req.method() {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut:
+		return true
+	}
+	return req.Retryable
+}
+
+// method of the request, http.MethodGet if not set.
+func (req *Request) method() string {
+	if req.Method == "" {
+		return http.MethodGet
+	}
+	return req.Method
+}
+
+// Send the request, and returns the contents and header of the response. It is meant for API calls: the response
+// is read into memory.
+//
+// Any status code other than 2xx is returned as a StatusError.
+//
+// Notice it may lock on the maximum number of parallel requests, so consider calling this on a separate goroutine.
+//
+// Failed attempts are retried according to the Manager's RetryPolicy, but only if the request is idempotent or
+// marked as Request.Retryable.
+func (m *Manager) Send(ctx context.Context, req *Request) (content []byte, header http.Header, err error) {
+	if !req.isRetryable() {
+		content, header, err = m.sendOnce(ctx, req)
+		return
+	}
+	err = m.withRetries(ctx, req.URL, func() error {
+		var attemptErr error
+		content, header, attemptErr = m.sendOnce(ctx, req)
+		return attemptErr
+	})
+	return
+}
+
+// Fetch the contents of the URL (using HTTP method "GET") into memory. It is meant for small API responses:
+// use Download for files.
+//
+// See Manager.Send for details.
+func (m *Manager) Fetch(ctx context.Context, url string) (content []byte, header http.Header, err error) {
+	return m.Send(ctx, &Request{URL: url})
+}
+
+// sendOnce implements one attempt of Send.
+func (m *Manager) sendOnce(ctx context.Context, req *Request) (content []byte, header http.Header, err error) {
+	if err = m.acquire(ctx); err != nil {
+		err = errors.WithMessagef(err, "while waiting to send request to %q", req.URL)
+		return
+	}
+	defer m.semaphore.Release()
+
+	method := req.method()
+	var body io.Reader
+	var contentLength int64
+	if req.Body != nil {
+		if contentLength, err = req.Body.Seek(0, io.SeekEnd); err == nil {
+			_, err = req.Body.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "failed to rewind body of request to %q", req.URL)
+			return
+		}
+		// Wrap it, so the http.Client doesn't close it.
+		body = io.NopCloser(req.Body)
+	}
+
+	client := m.client(checkRedirect)
+	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, body)
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating request for %q", req.URL)
+		return
+	}
+	httpReq.ContentLength = contentLength
+	if req.Body != nil && contentLength == 0 {
+		httpReq.Body = http.NoBody
+	}
+	if req.NoAuth {
+		if m.userAgent != "" {
+			httpReq.Header.Set("user-agent", m.userAgent)
+		}
+	} else {
+		m.setRequestHeader(httpReq)
+	}
+	for key, values := range req.Header {
+		httpReq.Header[http.CanonicalHeaderKey(key)] = values
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		err = errors.Wrapf(err, "failed request to %q", req.URL)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = errors.WithMessagef(newStatusError(req.URL, resp), "%s request to %q failed", method, req.URL)
+		return
+	}
+	content, err = io.ReadAll(m.throttledBody(ctx, resp, resp.Body))
+	if err != nil {
+		err = errors.Wrapf(err, "failed reading response from %q", req.URL)
+		return
+	}
+	header = resp.Header
+	return
+}
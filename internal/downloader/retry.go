@@ -0,0 +1,164 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy configures how the Manager retries requests that failed with a transient error: connection errors
+// (e.g.: connection reset) or one of the RetryableStatusCodes (e.g.: 429 "Too Many Requests", or 5xx errors).
+//
+// The delay before the n-th retry is BaseBackoff * 2^(n-1), capped at MaxBackoff, and randomly varied by
+// a fraction Jitter. If the server replies with a "Retry-After" header, it is honored instead, up to MaxRetryAfter:
+// if the server asks to wait longer, the request fails without further retries.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a request, including the first one.
+	// If set to <= 1, requests are not retried.
+	MaxAttempts int
+
+	// BaseBackoff is the delay before the first retry. It doubles for each following retry.
+	BaseBackoff time.Duration
+
+	// MaxBackoff limits the delay between retries.
+	MaxBackoff time.Duration
+
+	// MaxRetryAfter is the longest delay requested by the server with a "Retry-After" header that is honored.
+	// If the server asks for a longer delay, the request is not retried.
+	// If set to <= 0, MaxBackoff is used instead (and if that is also <= 0, there is no limit).
+	MaxRetryAfter time.Duration
+
+	// Jitter is the fraction (from 0 to 1) by which the delay is randomly increased or decreased, to avoid
+	// multiple clients retrying in lockstep.
+	Jitter float64
+
+	// RetryableStatusCodes are the HTTP status codes considered transient errors, worth retrying.
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryPolicy returns the RetryPolicy used by default: up to 5 attempts, with backoff starting at 1 second
+// and capped at 30 seconds, and 20% of jitter. Delays requested with "Retry-After" are honored up to 5 minutes.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:   5,
+		BaseBackoff:   time.Second,
+		MaxBackoff:    30 * time.Second,
+		MaxRetryAfter: 5 * time.Minute,
+		Jitter:        0.2,
+		RetryableStatusCodes: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry failed requests. The default is given by DefaultRetryPolicy.
+//
+// Use RetryPolicy{} (or MaxAttempts = 1) to disable retries.
+func (m *Manager) WithRetryPolicy(policy RetryPolicy) *Manager {
+	m.retryPolicy = policy
+	return m
+}
+
+// isRetryable returns whether err is a transient error that is worth retrying.
+func (p *RetryPolicy) isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return slices.Contains(p.RetryableStatusCodes, statusErr.StatusCode)
+	}
+	if errors.Is(err, CancellationError) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// backoff returns how long to wait before the given retry (starting from 1).
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseBackoff
+	for ii := 1; ii < retry && (p.MaxBackoff <= 0 || delay < p.MaxBackoff); ii++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
+
+// maxRetryAfter returns the longest "Retry-After" delay honored, or 0 if there is no limit.
+func (p *RetryPolicy) maxRetryAfter() time.Duration {
+	if p.MaxRetryAfter > 0 {
+		return p.MaxRetryAfter
+	}
+	return p.MaxBackoff
+}
+
+// withRetries calls attemptFn until it succeeds, it returns a non-retryable error, the maximum number of
+// attempts of the retry policy is reached, or the server asks to wait longer than the policy allows.
+//
+// It returns CancellationError if ctx is cancelled while waiting to retry.
+// The url is only used to log the retries.
+func (m *Manager) withRetries(ctx context.Context, url string, attemptFn func() error) error {
+	policy := m.retryPolicy
+	for attempt := 1; ; attempt++ {
+		err := attemptFn()
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.isRetryable(err) {
+			return err
+		}
+		delay := policy.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			if maxRetryAfter := policy.maxRetryAfter(); maxRetryAfter > 0 && statusErr.RetryAfter > maxRetryAfter {
+				return errors.WithMessagef(err, "not retrying: server asked to retry after %s, more than the maximum of %s",
+					statusErr.RetryAfter, maxRetryAfter)
+			}
+			delay = statusErr.RetryAfter
+		}
+		m.log().Info("retrying failed request", "url", url, "attempt", attempt, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return CancellationError
+		case <-timer.C:
+		}
+	}
+}
+
+// parseRetryAfter parses the value of a "Retry-After" header, which can be given in seconds or as an HTTP date.
+// It returns 0 if the value is empty or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
@@ -1,59 +1,172 @@
 package downloader
 
-import "sync"
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+)
 
-// Semaphore that allows dynamic resizing.
+// Semaphore that allows dynamic resizing, and prioritized acquisitions.
 //
 // It uses a sync.Cond, to allow dynamic resizing, so it will be slower than a pure channel version
 // of a semaphore, with a fixed capacity. This shouldn't matter for more coarse resource control.
 //
-// Implementation copied from github.com/gomlx/gomlx/types/xsync.
+// Implementation adapted from github.com/gomlx/gomlx/types/xsync.
 type Semaphore struct {
 	cond              sync.Cond
 	capacity, current int // Tracks capacity and current usage.
+
+	// waiting acquisitions, sorted by priority (higher first) and then by arrival order.
+	waiting []*semaphoreWaiter
+	nextSeq uint64
+
+	// lastServed is the number of acquisitions (numServed) when each group was last served.
+	lastServed map[string]uint64
+	numServed  uint64
+}
+
+// semaphoreWaiter is an acquisition waiting for a resource.
+type semaphoreWaiter struct {
+	priority int
+	group    string
+	seq      uint64
 }
 
 // NewSemaphore returns a Semaphore that allows at most capacity simultaneous acquisitions.
 // If capacity <= 0, there is no limit on acquisitions.
 //
-// FIFO ordering may be lost during resizes (Semaphore.Resize) to larger capacity, but otherwise it is respected.
+// Waiting acquisitions are served by priority (see Semaphore.AcquirePriority). For the same priority, they are
+// served in turns between groups (see Semaphore.AcquireGroup), and in FIFO order within each group.
 func NewSemaphore(capacity int) *Semaphore {
 	return &Semaphore{
-		cond:     sync.Cond{L: &sync.Mutex{}},
-		capacity: capacity,
+		cond:       sync.Cond{L: &sync.Mutex{}},
+		capacity:   capacity,
+		lastServed: make(map[string]uint64),
 	}
 }
 
 // Acquire resource observing current semaphore capacity.
 // It must be matched by exactly one call to Semaphore.Release after the reservation is no longer needed.
 func (s *Semaphore) Acquire() {
+	_ = s.AcquirePriority(context.Background(), 0)
+}
+
+// AcquireContext is like Acquire, but it stops waiting if ctx is cancelled, in which case it returns the
+// context error, and the resource is not acquired.
+//
+// If it returns nil, it must be matched by exactly one call to Semaphore.Release after the reservation is no
+// longer needed.
+func (s *Semaphore) AcquireContext(ctx context.Context) error {
+	return s.AcquirePriority(ctx, 0)
+}
+
+// AcquirePriority is like AcquireContext, but waiting acquisitions with higher priority are served first.
+// The default priority used by Acquire and AcquireContext is 0, and it can be negative.
+func (s *Semaphore) AcquirePriority(ctx context.Context, priority int) error {
+	return s.AcquireGroup(ctx, priority, "")
+}
+
+// AcquireGroup is like AcquirePriority, but the acquisition belongs to a group (e.g.: the downloads of one
+// repository): waiting acquisitions with the same priority are served in turns between their groups, starting
+// with the group served least recently, so one group with many acquisitions doesn't starve the others.
+// The default group used by AcquirePriority is "".
+func (s *Semaphore) AcquireGroup(ctx context.Context, priority int, group string) error {
+	if ctx.Done() != nil {
+		// Wake up waiters when the context is cancelled, so they can check for it.
+		stop := context.AfterFunc(ctx, func() {
+			s.cond.L.Lock()
+			defer s.cond.L.Unlock()
+			s.cond.Broadcast()
+		})
+		defer stop()
+	}
 	s.cond.L.Lock()
 	defer s.cond.L.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.capacity <= 0 {
+		// No limits.
+		s.current++
+		return nil
+	}
+	if len(s.waiting) == 0 && s.current < s.capacity {
+		s.served(group)
+		return nil
+	}
+
+	// Queue up: waiters are woken up with Broadcast, and only the next one to be served takes the resource.
+	w := &semaphoreWaiter{priority: priority, group: group, seq: s.nextSeq}
+	s.nextSeq++
+	pos, _ := slices.BinarySearchFunc(s.waiting, w, func(a, b *semaphoreWaiter) int {
+		if a.priority != b.priority {
+			return cmp.Compare(b.priority, a.priority)
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	s.waiting = slices.Insert(s.waiting, pos, w)
 	for {
-		if s.capacity <= 0 || s.current < s.capacity {
-			// No limits.
-			s.current++
-			return
+		if err := ctx.Err(); err != nil {
+			s.removeWaiter(w)
+			// The next waiter may now be able to proceed.
+			s.cond.Broadcast()
+			return err
+		}
+		if s.capacity <= 0 || (s.current < s.capacity && s.next() == w) {
+			s.removeWaiter(w)
+			s.served(group)
+			if len(s.waiting) > 0 && (s.capacity <= 0 || s.current < s.capacity) {
+				s.cond.Broadcast()
+			}
+			return nil
 		}
 		s.cond.Wait()
 	}
 }
 
+// next returns the waiter to be served next: among the ones with the highest priority, the first one of the group
+// served least recently. It must be called with the lock held, and at least one waiter.
+func (s *Semaphore) next() *semaphoreWaiter {
+	next := s.waiting[0]
+	for _, w := range s.waiting[1:] {
+		if w.priority != next.priority {
+			break
+		}
+		if s.lastServed[w.group] < s.lastServed[next.group] {
+			next = w
+		}
+	}
+	return next
+}
+
+// served takes a resource for the group. It must be called with the lock held.
+func (s *Semaphore) served(group string) {
+	s.current++
+	s.numServed++
+	s.lastServed[group] = s.numServed
+}
+
+// removeWaiter from the waiting queue. It must be called with the lock held.
+func (s *Semaphore) removeWaiter(w *semaphoreWaiter) {
+	if idx := slices.Index(s.waiting, w); idx >= 0 {
+		s.waiting = slices.Delete(s.waiting, idx, idx+1)
+	}
+}
+
 // Release resource previously allocated with Semaphore.Acquire.
 func (s *Semaphore) Release() {
 	s.cond.L.Lock()
 	defer s.cond.L.Unlock()
 	s.current--
-	if s.capacity == 0 || s.current < s.capacity-1 {
-		return
+	if len(s.waiting) > 0 {
+		s.cond.Broadcast()
 	}
-	s.cond.Signal()
 }
 
 // Resize number of available resources in the Semaphore.
 //
 // If newCapacity is larger than previous one, this may immediately allow pending Semaphore.Acquire to proceed.
-// Notice since all waiting Semaphore.Acquire are awoken (broadcast), the queue order may be lost.
 //
 // If newCapacity is smaller than previous one, it doesn't have any effect on current acquisitions. So if the Semaphore
 // is being used to control a worker pool, reducing its size won't stop workers currently executing.
@@ -63,14 +176,8 @@ func (s *Semaphore) Resize(newCapacity int) {
 	if newCapacity == s.capacity {
 		return // No change needed.
 	}
-	if (newCapacity > 0 && newCapacity < s.capacity) || s.capacity == 0 {
-		// Capacity is shrinking, no Semaphore.Acquire will be released.
-		s.capacity = newCapacity
-		return
-	}
-
-	// Wake-up everyone -- to preserve the queue order we would need to call s.cond.Signal() for the amount of
-	// increased capacity, but that would make this call O(capacity), potentially slow for large capacities.
 	s.capacity = newCapacity
-	s.cond.Broadcast()
+	if len(s.waiting) > 0 {
+		s.cond.Broadcast()
+	}
 }
@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithMetadataTimeout sets the maximum time to wait for the response of a request for metadata (see
+// Manager.FetchHeader). Timed out requests are retried, according to the RetryPolicy.
+// Set it to 0 (the default) for no timeout.
+func (m *Manager) WithMetadataTimeout(timeout time.Duration) *Manager {
+	m.metadataTimeout = timeout
+	return m
+}
+
+// WithDownloadTimeout sets the maximum time to wait for the server to respond to a download request, or to send
+// more data while downloading: it's not a limit on the total time of the download. Timed out downloads are
+// retried (resuming from where they stopped), according to the RetryPolicy.
+// Set it to 0 (the default) for no timeout.
+func (m *Manager) WithDownloadTimeout(timeout time.Duration) *Manager {
+	m.downloadTimeout = timeout
+	return m
+}
+
+// stallTimeout interrupts a request if the server takes longer than timeout to respond, or to send more data.
+//
+// A nil *stallTimeout is valid, and it never interrupts the request.
+type stallTimeout struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	expired atomic.Bool
+}
+
+// withStallTimeout returns a context for a request, that is cancelled if the server stalls for longer than timeout.
+// The timer is started immediately, to limit the wait for the response: call stallTimeout.pause once it's received,
+// and read the body with stallTimeout.reader. Use stallTimeout.resume to start it again for a new request.
+//
+// It returns ctx and a nil *stallTimeout if timeout is 0.
+// The returned stallTimeout must be closed when the request is finished.
+func withStallTimeout(ctx context.Context, timeout time.Duration) (context.Context, *stallTimeout) {
+	if timeout <= 0 {
+		return ctx, nil
+	}
+	s := &stallTimeout{timeout: timeout}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.timer = time.AfterFunc(timeout, func() {
+		s.expired.Store(true)
+		s.cancel()
+	})
+	return ctx, s
+}
+
+// resume the timer, e.g. before sending a new request.
+func (s *stallTimeout) resume() {
+	if s != nil {
+		s.timer.Reset(s.timeout)
+	}
+}
+
+// pause the timer, e.g. while the response is not being read.
+func (s *stallTimeout) pause() {
+	if s != nil {
+		s.timer.Stop()
+	}
+}
+
+// close releases the resources of the stallTimeout.
+func (s *stallTimeout) close() {
+	if s != nil {
+		s.timer.Stop()
+		s.cancel()
+	}
+}
+
+// stallTimeoutReader restarts the timer for each Read, and pauses it after it returns.
+type stallTimeoutReader struct {
+	s      *stallTimeout
+	reader io.Reader
+}
+
+// Read implements io.Reader.
+func (r *stallTimeoutReader) Read(p []byte) (n int, err error) {
+	r.s.timer.Reset(r.s.timeout)
+	n, err = r.reader.Read(p)
+	r.s.timer.Stop()
+	return n, err
+}
+
+// reader returns a reader that is interrupted if any read takes longer than the timeout.
+func (s *stallTimeout) reader(reader io.Reader) io.Reader {
+	if s == nil {
+		return reader
+	}
+	return &stallTimeoutReader{s: s, reader: reader}
+}
+
+// wrapErr returns a retryable timeout error if the timeout expired (err is then a consequence of the interruption),
+// or err otherwise.
+func (s *stallTimeout) wrapErr(url string, err error) error {
+	if s == nil || err == nil || !s.expired.Load() {
+		return err
+	}
+	// os.ErrDeadlineExceeded implements net.Error, and it's retried.
+	return errors.Wrapf(os.ErrDeadlineExceeded, "no response from %q for %s", url, s.timeout)
+}
@@ -38,7 +38,8 @@ const (
 // Currently, it only supports "SentencePiece" encoders, and it attempts to download details from
 // the repo files "tokenizer_config.json" and "tokenizer.json".
 //
-// If it fails to load those files, or create a tokenizer, it returns an error.
+// If it fails to load those files, or create a tokenizer, it returns an error. Errors from the HuggingFace Hub
+// (e.g.: hub.ErrGatedRepo) can be checked with errors.Is.
 func New(repo *hub.Repo) (Tokenizer, error) {
 	err := repo.DownloadInfo(false)
 	if err != nil {